@@ -4,10 +4,17 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
 	"os"
-	"regexp"
+	"path"
 	"slices"
 	"strings"
 	"sync"
@@ -15,32 +22,73 @@ import (
 	"time"
 )
 
+// GhRelType is where an addon is released, named before sources other than github were added
 type GhRelType uint8
 
 const (
 	GhRel = iota
 	GhTag
+	GlRel
+	GtRel
+	GtTag
+	CfRel
+	WiRel
+	WgRel
 	GhEnd // this should always be the last variant
 )
 
+// byDate reports if releases of relType are versioned by release date, otherwise by ref
+func (relType GhRelType) byDate() bool {
+	return relType == GhRel || relType == GlRel || relType == GtRel || relType == WiRel || relType == WgRel
+}
+
+// pinnable reports if addons of relType can be pinned to a version other than the latest
+func (relType GhRelType) pinnable() bool {
+	return relType != WiRel && relType != WgRel
+}
+
 type Addon struct {
-	// addon name from github, expected format PROJECT/ADDON
+	// addon name, the format depends on RelType: PROJECT/ADDON for github and gitea,
+	// GROUP[/SUBGROUP...]/ADDON for gitlab, curseforge/ID, wowinterface/ID or wago/SLUG.
+	// ADDON is everything after the last '/'
 	Name string
 	// top-level dirs to extract. empty list will extract everything except for excluded folders.
 	// folders starting with '-' will be excluded, takes priority over included dirs
 	Dirs []string `json:",omitempty"`
-	// 0|GhRel = github release (default); 1|GhTag = tagged commit
+	// 0|GhRel = github release (default); 1|GhTag = tagged commit; 2|GlRel = gitlab release;
+	// 3|GtRel = gitea/forgejo release; 4|GtTag = gitea/forgejo tag; 5|CfRel = curseforge file;
+	// 6|WiRel = wowinterface file; 7|WgRel = wago release
 	RelType GhRelType `json:",omitempty"`
+	// api base url of self-hosted instances, eg https://gitlab.example.com/api/v4 for GlRel or
+	// https://git.example.com/api/v1 for GtRel and GtTag. defaults to gitlab.com, codeberg.org,
+	// api.curseforge.com, api.mmoui.com and addons.wago.io
+	ApiUrl string `json:",omitempty"`
+	// project or file id for sources keyed by id (CfRel, WiRel) or project slug or id (WgRel),
+	// defaults to ADDON
+	ProjectId string `json:",omitempty"`
+	// least stable release channel to install for CfRel and WgRel: release (default, or stable),
+	// beta or alpha
+	Channel string `json:",omitempty"`
 	// skip updating this addon
 	Skip bool `json:",omitempty"`
-
-	// reference to AddonManager.UpdateInfo[Name]
+	// install this release tag (GhRel, GlRel, GtRel), tag or ref sha (GhTag, GtTag) or file id
+	// (CfRel) instead of the latest
+	Pin string `json:",omitempty"`
+	// what to do with releases that do not support the client interface version: warn (default),
+	// refuse or ignore
+	Compat string `json:",omitempty"`
+
+	// reference to Installation.UpdateInfo[Name]
 	*AddonUpdateInfo `json:"-"`
 	// top-level dirs to allow or skip extracting.  exclusions take prio over includeDirs if the
 	// same folder is listed in both
 	includeDirs, excludeDirs []string
-	// Name, projName, shortName = PROJECT/ADDON, PROJECT/, ADDON
+	// Name, projName, shortName = PROJECT/ADDON, PROJECT/, ADDON; projName keeps any subgroups
 	projName, shortName string
+	// installation this addon belongs to
+	install *Installation
+	// Installation.Flavor, game flavor to install releases for
+	flavor string
 
 	// shared/externally managed state
 	*addonSharedState
@@ -55,169 +103,496 @@ type AddonUpdateInfo struct {
 	RefSha string `json:",omitempty"`
 	// list of folders managed by us, deleted before extracting update
 	ExtractedDirs []string
+	// toc metadata of each extracted folder, folders without a toc are omitted
+	Toc map[string]*tocInfo `json:",omitempty"`
+	// validators for release metadata urls, sent as conditional requests so unchanged metadata
+	// is not downloaded again
+	HttpValidators map[string]*httpValidators `json:",omitempty"`
+	// Pin the installed version was resolved with, HttpValidators are not sent once Pin changes
+	PinnedTo string `json:",omitempty"`
 }
 
 type addonSharedState struct {
 	// internal buffer for io
 	buf *bytes.Buffer
-	// AddonManager.CacheDir
+	// AddonManager.CacheDir, nil if caching is disabled
 	cacheDir *os.Root
+	// Installation.AddonsDir, all addon files are extracted to and removed from here
+	addonsDir *os.Root
+	// http client shared by all addons and number of times to retry failed requests
+	client  *http.Client
+	retries int
+	// AddonManager.GithubToken or $GITHUB_TOKEN, only sent to the github api
+	githubToken string
+	// AddonManager.CurseForgeApiKey or $CURSEFORGE_API_KEY, only sent to the curseforge api
+	curseforgeApiKey string
+	// AddonManager.WagoApiKey or $WAGO_API_KEY, only sent to the wago api
+	wagoApiKey string
+	// validators of metadata fetched this run, saved to HttpValidators once the addon is up to date
+	validators map[string]*httpValidators
+	// archives shared between installations, nil when checking for updates
+	downloads *downloadCache
+	// owners of the top-level folders in addonsDir
+	owners *folderOwners
+	// AddonManager.Generations, number of previous versions kept per addon
+	generations int
 	// net and disk workers
 	netTasks, diskTasks chan<- func()
 	logs                chan<- string
+	// logs of the running net task, see deferLogf
+	netLogs []string
 }
 
 type addonUpdateStatus struct {
-	addon    *Addon
+	addon *Addon
+	// latest asset found by checkUpdate, nil if the check failed
+	asset *downloadAsset
+	// asset is newer than the installed version
+	hasUpdate bool
+	// latest version when it is newer than Pin, empty if the addon is not pinned
+	newer string
+	// top-level dirs in the asset's archive, only set by probe
+	zipDirs  []string
 	err      error
 	execTime time.Duration
 }
 
-func (a *Addon) update() *addonUpdateStatus {
+// fmtUpdateInfo formats the release date or ref of an update depending on relType
+func fmtUpdateInfo(relType GhRelType, t time.Time, ref string) string {
+	if relType.byDate() {
+		return tcDim(t.Local().Format("Jan 2, 2006"))
+	}
+	return tcDim(ref)
+}
+
+// findUpdate fetches the latest release info without downloading or modifying the addon
+func (a *Addon) findUpdate(ctx context.Context) *addonUpdateStatus {
 	status := &addonUpdateStatus{addon: a}
 
-	getUpdateInfo := func(t time.Time, ref string) string {
-		if a.RelType == GhRel {
-			return tcDim(t.Local().Format("Jan 2, 2006"))
+	a.Logf("checking for update (%v on %v)\n", tcGreen(a.Version), fmtUpdateInfo(a.RelType, a.UpdatedOn, a.RefSha))
+	asset, err := a.checkUpdate(ctx)
+	if errors.Is(err, errNotModified) {
+		// release info unchanged since we last updated
+		asset = &downloadAsset{Version: a.Version, UpdatedAt: a.UpdatedOn, RefSha: a.RefSha, RelType: a.RelType}
+	} else if err != nil {
+		status.err = a.Errorf("could not find update data for %v: %w", a.shortName, err)
+		return status
+	} else {
+		status.hasUpdate = a.hasUpdate(asset)
+	}
+	status.asset = asset
+
+	if a.Pin != "" {
+		// not knowing about newer versions should not fail the update
+		newer, err := a.newerThanPin(ctx)
+		if err != nil {
+			a.Logf("%v %v\n", tcYellow("unable to check for versions newer than pin:"), err)
 		}
-		return tcDim(ref)
+		status.newer = newer
+	}
+
+	return status
+}
+
+// pinInfo describes the pin of an addon for logs, empty if the addon is not pinned
+func (a *Addon) pinInfo(newer string) string {
+	if a.Pin == "" {
+		return ""
+	} else if newer == "" {
+		return tcDim(fmt.Sprintf(" (pinned to %v)", a.Pin))
+	}
+	return tcDim(fmt.Sprintf(" (pinned to %v, %v available)", a.Pin, tcGreen(newer)))
+}
+
+// check reports if an update is available without downloading it or modifying AddonUpdateInfo
+func (a *Addon) check(ctx context.Context) *addonUpdateStatus {
+	status := a.findUpdate(ctx)
+	if status.err != nil {
+		return status
+	}
+
+	asset := status.asset
+	updateInfo := fmtUpdateInfo(asset.RelType, asset.UpdatedAt, asset.RefSha)
+	if !status.hasUpdate {
+		a.Logf("no update found     (%v on %v)%v\n", tcGreen(asset.Version), updateInfo, a.pinInfo(status.newer))
+		return status
+	}
+
+	held := a.pinInfo(status.newer)
+	if a.Skip {
+		held = tcDim(" (held)")
+	} else if !a.compatible(asset.Interface) {
+		held = tcYellow(fmt.Sprintf(" (interface %v)", asset.Interface))
 	}
+	a.Logf("update available    (%v on %v -> %v on %v)%v\n", tcGreen(a.Version),
+		fmtUpdateInfo(a.RelType, a.UpdatedOn, a.RefSha), tcGreen(asset.Version), updateInfo, held)
 
-	a.Logf("checking for update (%v on %v)\n", tcGreen(a.Version), getUpdateInfo(a.UpdatedOn, a.RefSha))
-	asset, err := a.checkUpdate()
+	return status
+}
+
+// probe finds a release type that works for a new addon, trying releases before tagged commits
+// unless RelType is already set to tags, and lists the top-level dirs of the latest archive
+func (a *Addon) probe(ctx context.Context) *addonUpdateStatus {
+	status := &addonUpdateStatus{addon: a}
+
+	relTypes := []GhRelType{a.RelType}
+	switch a.RelType {
+	case GhRel:
+		relTypes = []GhRelType{GhRel, GhTag}
+	case GtRel:
+		relTypes = []GhRelType{GtRel, GtTag}
+	}
+
+	errs := []error{}
+	for _, relType := range relTypes {
+		a.RelType = relType
+		asset, err := a.checkUpdate(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		status.asset = asset
+		break
+	}
+	if status.asset == nil {
+		status.err = a.Errorf("no release or tagged commit found for %v: %w", a.Name, errors.Join(errs...))
+		return status
+	}
+
+	asset := status.asset
+	a.Logf("found %v on %v, downloading %v\n", tcGreen(asset.Version), fmtUpdateInfo(asset.RelType, asset.UpdatedAt, asset.RefSha), asset.Name)
+	if err := a.downloadZip(ctx, asset); err != nil {
+		status.err = a.Errorf("unable to download %v: %w", a.shortName, err)
+		return status
+	}
+
+	zipRd, err := zip.NewReader(bytes.NewReader(a.buf.Bytes()), int64(a.buf.Len()))
 	if err != nil {
-		status.err = a.Errorf("could not find update data for %v: %w", a.shortName, err)
+		status.err = a.Errorf("%v is not zip format: %w", asset.Name, err)
 		return status
 	}
+	for _, file := range zipRd.File {
+		if err := validZipEntry(file); err != nil {
+			status.err = a.Errorf("%w", err)
+			return status
+		}
+		if idx := strings.IndexByte(file.Name, '/'); idx != -1 && !slices.Contains(status.zipDirs, file.Name[:idx]) {
+			status.zipDirs = append(status.zipDirs, file.Name[:idx])
+		}
+	}
+	a.Logf("found folders %v\n", tcMagentaDim(fmt.Sprint(status.zipDirs)))
 
-	updateInfo := getUpdateInfo(asset.UpdatedAt, asset.RefSha)
-	if !a.hasUpdate(asset) {
-		a.Logf("no update found     (%v on %v)\n", tcGreen(asset.Version), updateInfo)
+	return status
+}
+
+func (a *Addon) update(ctx context.Context) *addonUpdateStatus {
+	status := a.findUpdate(ctx)
+	if status.err != nil {
+		return status
+	}
+
+	asset := status.asset
+	updateInfo := fmtUpdateInfo(asset.RelType, asset.UpdatedAt, asset.RefSha)
+	if !status.hasUpdate {
+		a.Logf("no update found     (%v on %v)%v\n", tcGreen(asset.Version), updateInfo, a.pinInfo(status.newer))
+		a.HttpValidators = a.validators
+		a.PinnedTo = a.Pin
 		return status
 	} else if a.Skip {
 		a.Logf("skipping update     (%v on %v)\n", tcGreen(asset.Version), updateInfo)
 		return status
+	} else if !a.compatible(asset.Interface) {
+		msg := fmt.Sprintf("release supports interface %v, client is %v", asset.Interface, a.clientInterface())
+		if a.Compat == CompatRefuse {
+			a.Logf("%v (%v on %v) %v\n", tcYellow("refusing update   "), tcGreen(asset.Version), updateInfo, msg)
+			return status
+		}
+		a.Logf("%v %v\n", tcYellow("warning:"), msg)
 	}
 
 	a.Logf("downloading update  (%v on %v) %v\n", tcGreen(asset.Version), updateInfo, asset.Name)
-	if err = a.downloadZip(asset); err != nil {
+	if err := a.downloadZip(ctx, asset); err != nil {
 		status.err = a.Errorf("unable to download update for %v: %w", a.shortName, err)
 		return status
 	}
 
 	a.Logf("unzipping\n")
-	if err = a.extractZip(); err != nil {
+	extractedDirs, err := a.extractZip(ctx)
+	if err != nil {
 		status.err = a.Errorf("error extracting update for %v: %w", a.shortName, err)
 		return status
 	}
-	a.Logf("extracted %v\n", tcMagentaDim(fmt.Sprint(a.ExtractedDirs)))
+	a.Logf("extracted %v\n", tcMagentaDim(fmt.Sprint(extractedDirs)))
+
+	// the update is already installed, a toc that cannot be read is not an error
+	tocs, err := readTocs(a.addonsDir, extractedDirs, a.flavor)
+	if err != nil {
+		a.Logf("%v %v\n", tcYellow("unable to read toc:"), err)
+	}
+	for _, dir := range extractedDirs {
+		if toc := tocs[dir]; toc != nil && !a.compatible(toc.Interface) {
+			a.Logf("%v %v supports interface %v, client is %v\n", tcYellow("warning:"), dir, toc.Interface, a.clientInterface())
+		}
+	}
 
+	// only update info once the update is fully installed
+	a.ExtractedDirs = extractedDirs
+	a.Toc = tocs
 	a.Version = asset.Version
 	a.UpdatedOn = asset.UpdatedAt
 	a.RefSha = asset.RefSha
+	a.HttpValidators = a.validators
+	a.PinnedTo = a.Pin
 
 	return status
 }
 
 func (a *Addon) hasUpdate(asset *downloadAsset) bool {
-	return (asset.RelType == GhRel && a.UpdatedOn.Before(asset.UpdatedAt)) ||
-		(asset.RelType == GhTag && a.RefSha != asset.RefSha)
+	// pins can go back to older releases
+	if a.Pin != "" && asset.RelType.byDate() {
+		return !a.UpdatedOn.Equal(asset.UpdatedAt)
+	}
+
+	switch {
+	case asset.RelType == WiRel:
+		// a new version, or the same version uploaded again
+		return a.Version != asset.Version || a.UpdatedOn.Before(asset.UpdatedAt)
+	case asset.RelType.byDate():
+		return a.UpdatedOn.Before(asset.UpdatedAt)
+	default:
+		return a.RefSha != asset.RefSha
+	}
 }
 
-func (a *Addon) extractZip() error {
-	// remove ExtractedDir from previous update
-	// loop over zip files, creating all dirs first, save files to temp slice
-	//   filter file ex/inclusions and update ExtractedDirs
-	// extract files from temp slice
+// staging and backup dirs are kept inside AddonsDir so installing an update is a rename within the
+// AddonsDir root, on the same filesystem. wow ignores them as they have no .toc of their own, scan
+// skips them with isInternalDir in case an interrupted run left them behind
+const (
+	stagingDir = ".wau-staging"
+	backupDir  = ".wau-backup"
+)
+
+// extractZip installs the zip in buf, returning the top-level dirs that were installed. the zip is
+// extracted to a staging dir first and swapped in once fully extracted, previously installed dirs
+// are restored if any step fails. cancelling ctx stops extracting, but does not interrupt a swap
+// that has already started
+func (a *Addon) extractZip(ctx context.Context) ([]string, error) {
+	// loop over zip files, filtering file ex/inclusions and collecting top-level dirs
+	// extract files to staging dir
+	// swap staged dirs with ExtractedDirs from previous update
 	zipRd, err := zip.NewReader(bytes.NewReader(a.buf.Bytes()), int64(a.buf.Len()))
 	if err != nil {
-		return fmt.Errorf("addon update for %v not zip format: %w", a.shortName, err)
+		return nil, fmt.Errorf("addon update for %v not zip format: %w", a.shortName, err)
 	}
 
-	addonsDir := "./"
-	if a.cacheDir != nil {
-		addonsDir = a.cacheDir.Name() + "/addons/"
+	// unique per addon so updates can be staged concurrently
+	addonDir := addonDirName(a.Name)
+	stageDir := stagingDir + "/" + addonDir
+	if err := a.addonsDir.RemoveAll(stageDir); err != nil {
+		return nil, fmt.Errorf("error clearing staging dir %v: %w", stageDir, err)
 	}
+	defer a.addonsDir.RemoveAll(stageDir)
 
-	// delete previously extracted dirs
-	for _, dir := range a.ExtractedDirs {
-		if err := os.RemoveAll(dir); err != nil {
-			return fmt.Errorf("error removing previously installed addon dir %v: %w", dir, err)
-		}
-	}
-	a.ExtractedDirs = a.ExtractedDirs[:0]
-
-	// create all dirs before extracting files
 	extractFiles := make([]*zip.File, 0, len(zipRd.File))
-	topLevelDirs := map[string]bool{} // unique set of top level dirs for ExtractedDirs
+	extractedDirs := []string{}
 	for _, file := range zipRd.File {
-		if skipUnzip(a, file.Name) {
+		// reject the whole archive if any entry is unsafe, even if it would be skipped
+		if err := validZipEntry(file); err != nil {
+			return nil, err
+		}
+
+		// files at the root of the zip are not part of any addon folder
+		idx := strings.IndexByte(file.Name, '/')
+		if idx == -1 || skipUnzip(a, file.Name) {
 			continue
 		}
 
-		if file.Mode().IsDir() {
-			parentDir := file.Name[:strings.IndexByte(file.Name, '/')]
-			if _, ok := topLevelDirs[parentDir]; !ok {
-				a.ExtractedDirs = append(a.ExtractedDirs, parentDir)
-				topLevelDirs[parentDir] = true
-			}
+		if topLevelDir := file.Name[:idx]; !slices.Contains(extractedDirs, topLevelDir) {
+			extractedDirs = append(extractedDirs, topLevelDir)
+		}
 
-			subDir := addonsDir + file.Name
-			if err := os.MkdirAll(addonsDir+file.Name, file.Mode()); err != nil {
-				return fmt.Errorf("error creating dir %v: %w", subDir, err)
-			}
-		} else {
+		// create dirs for every entry, zips are not required to have entries for parent dirs
+		dir := file.Name
+		if !file.Mode().IsDir() {
+			dir = dir[:strings.LastIndexByte(dir, '/')]
 			extractFiles = append(extractFiles, file)
 		}
+		if err := a.addonsDir.MkdirAll(stageDir+"/"+dir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating dir %v: %w", dir, err)
+		}
+	}
+	if len(extractedDirs) == 0 {
+		return nil, fmt.Errorf("no addon folders found in archive")
+	}
+
+	// resolve folders already installed by other addons, the claim is undone if the update fails
+	claimedDirs, err := a.owners.claim(a.Name, extractedDirs)
+	if err != nil {
+		return nil, err
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			a.owners.set(a.Name, a.ExtractedDirs)
+		}
+	}()
+
+	for _, dir := range extractedDirs {
+		if slices.Contains(claimedDirs, dir) {
+			continue
+		} else if others := a.owners.others(a.Name, dir); len(others) != 0 {
+			a.Logf("skipping %v, already installed by %v\n", dir, strings.Join(others, ", "))
+		}
+	}
+	if len(claimedDirs) == 0 {
+		return nil, fmt.Errorf("every folder in archive is already installed by other addons")
 	}
+	extractFiles = slices.DeleteFunc(extractFiles, func(file *zip.File) bool {
+		return !slices.Contains(claimedDirs, file.Name[:strings.IndexByte(file.Name, '/')])
+	})
+	extractedDirs = claimedDirs
 
-	unzipErr := &atomic.Bool{}
+	unzipErr := &atomic.Pointer[error]{}
 	wg := &sync.WaitGroup{}
 	wg.Add(len(extractFiles))
 
 	// extract zip files
 	// todo: check zip is thread safe
 	for _, zipFile := range extractFiles {
-		if unzipErr.Load() {
+		if unzipErr.Load() != nil {
 			wg.Done()
 			continue
 		}
 
-		unzipFile := func() bool {
+		unzipFile := func() error {
 			zipF, err := zipFile.Open()
 			if err != nil {
-				return false
+				return err
 			}
 			defer zipF.Close()
 
-			addonFilename := addonsDir + zipFile.Name
-			file, err := os.OpenFile(addonFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, zipFile.Mode())
+			file, err := a.addonsDir.OpenFile(stageDir+"/"+zipFile.Name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, zipFile.Mode())
 			if err != nil {
-				return false
+				return err
 			}
 			defer file.Close()
 
 			writer := bufio.NewWriter(file)
 			if _, err := io.Copy(writer, zipF); err != nil {
-				return false
+				return err
 			}
-			if err := writer.Flush(); err != nil {
-				return false
-			}
-
-			return true
+			return writer.Flush()
 		}
 		a.diskTasks <- func() {
 			defer wg.Done()
-			if !unzipFile() {
-				unzipErr.Store(true)
+			if err := ctx.Err(); err != nil {
+				unzipErr.CompareAndSwap(nil, &err)
+				return
+			}
+			if err := unzipFile(); err != nil {
+				err = fmt.Errorf("%v: %w", zipFile.Name, err)
+				unzipErr.CompareAndSwap(nil, &err)
 			}
 		}
 	}
 	wg.Wait()
 
-	if unzipErr.Load() {
-		return fmt.Errorf("error unzipping archive")
+	if err := unzipErr.Load(); err != nil {
+		return nil, fmt.Errorf("error unzipping archive: %w", *err)
+	} else if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock := a.owners.lockSwap()
+	defer unlock()
+	if err := a.swapDirs(stageDir, backupDir+"/"+addonDir, extractedDirs); err != nil {
+		return nil, err
+	}
+	swapped = true
+	a.owners.set(a.Name, extractedDirs)
+	if err := a.pruneGenerations(); err != nil {
+		a.Logf("%v %v\n", tcYellow("unable to remove old generations:"), err)
+	}
+
+	return extractedDirs, nil
+}
+
+// swapDirs replaces ExtractedDirs with newDirs from stageDir. replaced dirs are moved to backupDir
+// and restored if any dir could not be swapped in, or kept as a generation once every dir is
+// swapped in. previous dirs still owned by other addons are left in place
+func (a *Addon) swapDirs(stageDir, backupDir string, newDirs []string) (err error) {
+	if err := a.addonsDir.RemoveAll(backupDir); err != nil {
+		return fmt.Errorf("error clearing backup dir %v: %w", backupDir, err)
+	}
+	if err := a.addonsDir.MkdirAll(backupDir, 0755); err != nil {
+		return fmt.Errorf("error creating backup dir %v: %w", backupDir, err)
+	}
+	defer a.addonsDir.RemoveAll(backupDir)
+
+	backedUp, installed := []string{}, []string{}
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		// undo the swap, removing new dirs before restoring the dirs they replaced
+		for _, dir := range installed {
+			if rmErr := a.addonsDir.RemoveAll(dir); rmErr != nil {
+				err = errors.Join(err, fmt.Errorf("error removing partially installed dir %v: %w", dir, rmErr))
+			}
+		}
+		for _, dir := range backedUp {
+			if mvErr := a.addonsDir.Rename(backupDir+"/"+dir, dir); mvErr != nil {
+				err = errors.Join(err, fmt.Errorf("error restoring previously installed dir %v: %w", dir, mvErr))
+			}
+		}
+	}()
+
+	// move previously installed dirs, and any existing dirs about to be replaced, out of the way
+	for _, dir := range slices.Concat(a.ExtractedDirs, newDirs) {
+		if slices.Contains(backedUp, dir) {
+			continue
+		} else if !slices.Contains(newDirs, dir) && len(a.owners.others(a.Name, dir)) != 0 {
+			continue
+		}
+		if _, err := a.addonsDir.Lstat(dir); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err := a.addonsDir.Rename(dir, backupDir+"/"+dir); err != nil {
+			return fmt.Errorf("error moving previously installed dir %v: %w", dir, err)
+		}
+		backedUp = append(backedUp, dir)
+	}
+
+	for _, dir := range newDirs {
+		if err := a.addonsDir.Rename(stageDir+"/"+dir, dir); err != nil {
+			return fmt.Errorf("error installing dir %v: %w", dir, err)
+		}
+		installed = append(installed, dir)
+	}
+
+	// the new dirs are installed, losing the previous version only prevents rolling back to it
+	if err := a.keepGeneration(backupDir, backedUp); err != nil {
+		a.Logf("%v %v\n", tcYellow("unable to keep previous version:"), err)
+	}
+
+	return nil
+}
+
+// validZipEntry checks file can be safely extracted: only regular files and dirs with a relative
+// path that stays inside its top-level dir (no "..", "." or empty path elements)
+func validZipEntry(file *zip.File) error {
+	mode := file.Mode()
+	if !mode.IsRegular() && !mode.IsDir() {
+		return fmt.Errorf("unsupported zip entry %v: %v", file.Name, mode.Type())
+	}
+
+	name := strings.TrimSuffix(file.Name, "/")
+	// backslashes and colons are path separators or volume names on windows
+	if !fs.ValidPath(name) || name == "." || strings.ContainsAny(name, `\:`) {
+		return fmt.Errorf("unsafe path in zip entry %q", file.Name)
 	}
 
 	return nil
@@ -241,12 +616,23 @@ func skipUnzip(addon *Addon, filename string) bool {
 	return len(addon.includeDirs) != 0
 }
 
-func (a *Addon) downloadZip(asset *downloadAsset) error {
+func (a *Addon) downloadZip(ctx context.Context, asset *downloadAsset) error {
 	cacheFilename := fmt.Sprintf("%v-%v", a.shortName, asset.Name)
 	a.buf.Reset()
+
+	// another installation already downloaded this archive
+	if data := a.downloads.get(a.Name, asset.DownloadUrl); data != nil {
+		a.buf.Write(data)
+		return nil
+	}
+
 	a.buf.Grow(int(asset.Size))
+	if err := a.cacheDownload(ctx, asset.DownloadUrl, cacheFilename, false); err != nil {
+		return err
+	}
+	a.downloads.put(a.Name, asset.DownloadUrl, a.buf.Bytes())
 
-	return a.cacheDownload(asset.DownloadUrl, cacheFilename)
+	return nil
 }
 
 type downloadAsset struct {
@@ -258,16 +644,30 @@ type downloadAsset struct {
 	RefSha      string
 	Version     string
 	RelType     GhRelType
+	// interface versions from release.json, empty if unknown
+	Interface []int `json:"-"`
 }
 
-func (a *Addon) checkUpdate() (*downloadAsset, error) {
+func (a *Addon) checkUpdate(ctx context.Context) (*downloadAsset, error) {
 	switch a.RelType {
 	case GhRel:
-		return a.getTaggedRelease()
+		return a.getTaggedRelease(ctx)
 	case GhTag:
-		return a.getTaggedRef()
+		return a.getTaggedRef(ctx)
+	case GlRel:
+		return a.getGitlabRelease(ctx)
+	case GtRel:
+		return a.getGiteaRelease(ctx)
+	case GtTag:
+		return a.getGiteaTag(ctx)
+	case CfRel:
+		return a.getCurseforgeFile(ctx)
+	case WiRel:
+		return a.getWowinterfaceFile(ctx)
+	case WgRel:
+		return a.getWagoRelease(ctx)
 	default:
-		return nil, fmt.Errorf("unknown github release type %v", a.RelType)
+		return nil, fmt.Errorf("unknown release type %v", a.RelType)
 	}
 }
 
@@ -288,47 +688,72 @@ type releaseMetadata struct {
 	Interface int
 }
 
-func (a *Addon) getTaggedRelease() (*downloadAsset, error) {
+func (a *Addon) getTaggedRelease(ctx context.Context) (*downloadAsset, error) {
 	const RelEndpoint = "https://api.github.com/repos/%v/releases/latest"
-	releaseManifest := func(a *downloadAsset) bool { return a.ContentType == "application/json" && a.Name == "release.json" }
+	const PinnedRelEndpoint = "https://api.github.com/repos/%v/releases/tags/%v"
 
 	cacheFilename := fmt.Sprintf("%v-rel.json", a.shortName)
+	endpoint := fmt.Sprintf(RelEndpoint, a.Name)
+	if a.Pin != "" {
+		cacheFilename = fmt.Sprintf("%v-rel-%v.json", a.shortName, url.PathEscape(a.Pin))
+		endpoint = fmt.Sprintf(PinnedRelEndpoint, a.Name, url.PathEscape(a.Pin))
+	}
 
-	ghRelease, err := fetchJson[ghTaggedRel](a, fmt.Sprintf(RelEndpoint, a.Name), cacheFilename)
+	ghRelease, err := fetchJson[ghTaggedRel](ctx, a, endpoint, cacheFilename)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching update info: %w", err)
 	}
 
-	addonReleases := &releaseInfo{}
-	if idx := slices.IndexFunc(ghRelease.Assets, releaseManifest); idx != -1 {
-		relAsset := ghRelease.Assets[idx]
-		cacheRelManifest := fmt.Sprintf("%v-addonRel.json", a.shortName)
-
-		addonReleases, err = fetchJson[releaseInfo](a, relAsset.DownloadUrl, cacheRelManifest)
-		if err != nil {
-			return nil, fmt.Errorf("error fetching release manifest: %w", err)
-		}
+	addonReleases, err := a.fetchReleaseManifest(ctx, ghRelease)
+	if err != nil {
+		return nil, err
 	}
 
 	return a.findTaggedRel(ghRelease, addonReleases)
 }
 
+// fetchReleaseManifest fetches the release.json asset of ghRelease, returns an empty manifest if
+// the release has none
+func (a *Addon) fetchReleaseManifest(ctx context.Context, ghRelease *ghTaggedRel) (*releaseInfo, error) {
+	releaseManifest := func(a *downloadAsset) bool { return a.ContentType == "application/json" && a.Name == "release.json" }
+
+	idx := slices.IndexFunc(ghRelease.Assets, releaseManifest)
+	if idx == -1 {
+		return &releaseInfo{}, nil
+	}
+
+	relAsset := ghRelease.Assets[idx]
+	cacheRelManifest := fmt.Sprintf("%v-addonRel.json", a.shortName)
+	addonReleases, err := fetchJson[releaseInfo](ctx, a, relAsset.DownloadUrl, cacheRelManifest)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching release manifest: %w", err)
+	}
+
+	return addonReleases, nil
+}
+
 func (a *Addon) findTaggedRel(ghRelease *ghTaggedRel, addonReleases *releaseInfo) (*downloadAsset, error) {
 	// invariant: ghRelease and addonReleases will not be nil when called from getTaggedRelease
-	classicFlavors := regexp.MustCompile(`classic|bc|wrath|cata`)
-	isMainline := func(m *releaseMetadata) bool { return m.Flavor == "mainline" }
+	flavor := cmp.Or(a.flavor, FlavorMainline)
+	isFlavor := func(m *releaseMetadata) bool { return m.Flavor == flavor }
 
 	isReleaseAsset := func(a *downloadAsset) bool {
-		return a.ContentType == "application/zip" && !classicFlavors.MatchString(a.Name)
+		return a.ContentType == "application/zip" && isFlavorAsset(a.Name, flavor)
 	}
 	version := ghRelease.TagName
+	ifaces := []int{}
 
 	for _, addonRelInfo := range addonReleases.Releases {
-		if slices.ContainsFunc(addonRelInfo.Metadata, isMainline) {
+		if slices.ContainsFunc(addonRelInfo.Metadata, isFlavor) {
 			isReleaseAsset = func(a *downloadAsset) bool {
 				return a.ContentType == "application/zip" && a.Name == addonRelInfo.Filename
 			}
 			version = addonRelInfo.Version
+			for _, m := range addonRelInfo.Metadata {
+				if isFlavor(m) && m.Interface != 0 {
+					ifaces = append(ifaces, m.Interface)
+				}
+			}
 
 			break
 		}
@@ -342,10 +767,25 @@ func (a *Addon) findTaggedRel(ghRelease *ghTaggedRel, addonReleases *releaseInfo
 	asset := ghRelease.Assets[idx]
 	asset.RelType = GhRel
 	asset.Version = version
+	asset.Interface = ifaces
 
 	return asset, nil
 }
 
+// newLinkedAsset creates a release asset for hosts that do not report content types, guessing the
+// content type from the extension of name
+func newLinkedAsset(name, downloadUrl string, updatedAt time.Time) *downloadAsset {
+	asset := &downloadAsset{Name: name, DownloadUrl: downloadUrl, UpdatedAt: updatedAt}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".zip":
+		asset.ContentType = "application/zip"
+	case ".json":
+		asset.ContentType = "application/json"
+	}
+
+	return asset
+}
+
 type ghTaggedRef struct {
 	Ref    string
 	Object struct {
@@ -353,18 +793,91 @@ type ghTaggedRef struct {
 	}
 }
 
-func (a *Addon) getTaggedRef() (*downloadAsset, error) {
+func (a *Addon) getTaggedRef(ctx context.Context) (*downloadAsset, error) {
 	const TagEndpoint = "https://api.github.com/repos/%v/git/refs/tags"
 	cacheFilename := fmt.Sprintf("%v-ref.json", a.shortName)
 
-	ghRefs, err := fetchJson[[]ghTaggedRef](a, fmt.Sprintf(TagEndpoint, a.Name), cacheFilename)
+	ghRefs, err := fetchJson[[]ghTaggedRef](ctx, a, fmt.Sprintf(TagEndpoint, a.Name), cacheFilename)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching tagged ref: %w", err)
 	}
 
+	if a.Pin != "" {
+		idx := slices.IndexFunc(*ghRefs, a.isPinnedRef)
+		if idx == -1 {
+			return nil, fmt.Errorf("pinned tag or ref %v not found", a.Pin)
+		}
+		return a.findTaggedRef((*ghRefs)[idx : idx+1])
+	}
+
 	return a.findTaggedRef(*ghRefs)
 }
 
+// isPinnedRef reports if ref is the tag or ref sha (or a prefix of it) in Pin
+func (a *Addon) isPinnedRef(ref ghTaggedRef) bool {
+	return ref.Ref == "refs/tags/"+a.Pin || (len(a.Pin) >= 7 && strings.HasPrefix(ref.Object.Sha, a.Pin))
+}
+
+// newerThanPin returns the latest release tag or tagged ref if it is not the pinned version. the
+// latest version is always requested in full, its validators are not saved while pinned
+func (a *Addon) newerThanPin(ctx context.Context) (string, error) {
+	const RelEndpoint = "https://api.github.com/repos/%v/releases/latest"
+	const TagEndpoint = "https://api.github.com/repos/%v/git/refs/tags"
+
+	switch a.RelType {
+	case GhRel:
+		cacheFilename := fmt.Sprintf("%v-rel.json", a.shortName)
+		ghRelease, err := decodeJson[ghTaggedRel](ctx, a, fmt.Sprintf(RelEndpoint, a.Name), cacheFilename, false)
+		if err != nil {
+			return "", err
+		} else if ghRelease.TagName == a.Pin {
+			return "", nil
+		}
+		return ghRelease.TagName, nil
+	case GhTag:
+		cacheFilename := fmt.Sprintf("%v-ref.json", a.shortName)
+		ghRefs, err := decodeJson[[]ghTaggedRef](ctx, a, fmt.Sprintf(TagEndpoint, a.Name), cacheFilename, false)
+		if err != nil {
+			return "", err
+		} else if len(*ghRefs) == 0 || a.isPinnedRef((*ghRefs)[len(*ghRefs)-1]) {
+			return "", nil
+		}
+		latest := (*ghRefs)[len(*ghRefs)-1].Ref
+		return latest[strings.LastIndexByte(latest, '/')+1:], nil
+	case GlRel:
+		endpoint, cacheFilename := a.gitlabRelease("")
+		glRel, err := decodeJson[glRelease](ctx, a, endpoint, cacheFilename, false)
+		if err != nil {
+			return "", err
+		} else if glRel.TagName == a.Pin {
+			return "", nil
+		}
+		return glRel.TagName, nil
+	case GtRel:
+		endpoint, cacheFilename := a.giteaRelease("")
+		gtRel, err := decodeJson[giteaRelease](ctx, a, endpoint, cacheFilename, false)
+		if err != nil {
+			return "", err
+		} else if gtRel.TagName == a.Pin {
+			return "", nil
+		}
+		return gtRel.TagName, nil
+	case GtTag:
+		endpoint, cacheFilename := a.giteaTags()
+		gtTags, err := decodeJson[[]giteaTag](ctx, a, endpoint, cacheFilename, false)
+		if err != nil {
+			return "", err
+		} else if len(*gtTags) == 0 || a.isPinnedTag((*gtTags)[0]) {
+			return "", nil
+		}
+		return (*gtTags)[0].Name, nil
+	case CfRel:
+		return a.newerCurseforgeFile(ctx)
+	default:
+		return "", nil
+	}
+}
+
 func (a *Addon) findTaggedRef(ghRefs []ghTaggedRef) (*downloadAsset, error) {
 	if len(ghRefs) == 0 {
 		return nil, fmt.Errorf("did not find valid ref for %v", a.Name)
@@ -389,10 +902,96 @@ func (a *Addon) findTaggedRef(ghRefs []ghTaggedRef) (*downloadAsset, error) {
 	return asset, nil
 }
 
+func (a *Addon) String() string {
+	buf := &strings.Builder{}
+
+	fmt.Fprintf(buf, "%v%v\n", tcDim(a.projName), tcCyan(a.shortName))
+	fmt.Fprintln(buf, "  Dirs:           ", a.Dirs)
+	fmt.Fprintln(buf, "  RelType:        ", a.RelType)
+	if a.ApiUrl != "" {
+		fmt.Fprintln(buf, "  ApiUrl:         ", a.ApiUrl)
+	}
+	if a.ProjectId != "" {
+		fmt.Fprintln(buf, "  ProjectId:      ", a.ProjectId)
+	}
+	if a.Channel != "" {
+		fmt.Fprintln(buf, "  Channel:        ", a.Channel)
+	}
+	fmt.Fprintln(buf, "  Skip:           ", a.Skip)
+	fmt.Fprintln(buf, "  Pin:            ", a.Pin)
+	fmt.Fprintln(buf, "  Compat:         ", cmp.Or(a.Compat, CompatWarn))
+	fmt.Fprintln(buf, "  includeDirs:    ", a.includeDirs)
+	fmt.Fprintln(buf, "  excludeDirs:    ", a.excludeDirs)
+	fmt.Fprintln(buf, "  addonUpdateInfo:")
+	fmt.Fprintln(buf, "    Version:      ", a.AddonUpdateInfo.Version)
+	fmt.Fprintln(buf, "    UpdatedOn:    ", a.AddonUpdateInfo.UpdatedOn)
+	fmt.Fprintln(buf, "    RefSha:       ", a.AddonUpdateInfo.RefSha)
+	fmt.Fprintln(buf, "    ExtractedDirs:", a.AddonUpdateInfo.ExtractedDirs)
+	for _, dir := range a.AddonUpdateInfo.ExtractedDirs {
+		toc := a.Toc[dir]
+		if toc == nil {
+			continue
+		}
+		fmt.Fprintf(buf, "    %v:\n", dir)
+		fmt.Fprintln(buf, "      Title:         ", toc.plainTitle(dir))
+		fmt.Fprintln(buf, "      Version:       ", toc.Version)
+		fmt.Fprintln(buf, "      Interface:     ", toc.Interface)
+		fmt.Fprintln(buf, "      Dependencies:  ", toc.Dependencies)
+		fmt.Fprintln(buf, "      OptionalDeps:  ", toc.OptionalDeps)
+		fmt.Fprintln(buf, "      SavedVariables:", toc.SavedVariables)
+		for _, tag := range slices.Sorted(maps.Keys(toc.Extra)) {
+			fmt.Fprintf(buf, "      %-15v %v\n", tag+":", toc.Extra[tag])
+		}
+	}
+
+	return buf.String()
+}
+
+// clientInterface is the interface version of the addon's client, 0 if unknown
+func (a *Addon) clientInterface() int {
+	if a.install == nil {
+		return 0
+	}
+	return a.install.iface
+}
+
+// compatible reports if a release or toc supporting ifaces is compatible with the client, always
+// true if the addon ignores compatibility
+func (a *Addon) compatible(ifaces []int) bool {
+	return a.Compat == CompatIgnore || compatibleInterface(ifaces, a.clientInterface())
+}
+
+// mainToc returns the toc of the folder named after the addon, or the first extracted folder with
+// a toc. returns "", nil if no tocs are known
+func (a *Addon) mainToc() (string, *tocInfo) {
+	dirs := a.ExtractedDirs
+	if idx := slices.IndexFunc(dirs, func(dir string) bool { return strings.EqualFold(dir, a.shortName) }); idx != -1 {
+		dirs = slices.Concat(dirs[idx:idx+1], dirs)
+	}
+
+	for _, dir := range dirs {
+		if toc := a.Toc[dir]; toc != nil {
+			return dir, toc
+		}
+	}
+	return "", nil
+}
+
 func (a *Addon) Logf(format string, args ...any) {
+	a.logs <- a.logLine(format, args...)
+}
+
+// deferLogf is Logf for net tasks, lines are logged by cacheDownload once the task is done. logs
+// are only printed on the addon's turn, a net worker blocked on a full log buffer could stall the
+// addon being printed
+func (a *Addon) deferLogf(format string, args ...any) {
+	a.netLogs = append(a.netLogs, a.logLine(format, args...))
+}
+
+// logLine prefixes a log line with the addon's name
+func (a *Addon) logLine(format string, args ...any) string {
 	args = append([]any{tcDim(a.projName), tcCyan(a.shortName)}, args...)
-	msg := fmt.Sprintf("[%v%v] "+format, args...)
-	a.logs <- msg
+	return fmt.Sprintf("[%v%v] "+format, args...)
 }
 
 func (a *Addon) Errorf(format string, args ...any) error {
@@ -2,32 +2,67 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	DefaultNetTasks  = 2
-	DefaultDiskTasks = 32
+	DefaultNetTasks    = 2
+	DefaultDiskTasks   = 32
+	DefaultRetries     = 3
+	DefaultGenerations = 2
 )
 
 type AddonManager struct {
-	Addons []*Addon
+	// default installation, kept at the top level for compatibility with single install configs
+	Installation
+	// additional installations, all installations are updated in a single run sharing downloads
+	Installations []*Installation `json:",omitempty"`
 	// addons that are not managed by us, typically map of urls
 	UnmanagedAddons []string
-	// map of addon name to update info, only used when (de)serializing. most likely should use
-	// Addon.AddonUpdateInfo instead
-	UpdateInfo map[string]*AddonUpdateInfo
+	// map of addon folder to the addon providing it, PROJECT/ADDON. used to resolve missing
+	// dependencies listed in tocs
+	DependencyRepos map[string]string `json:",omitempty"`
+	// how to handle top-level folders installed by more than one addon: error (default), first or
+	// shared. shared folders are only removed once no addon installs them
+	FolderConflicts string `json:",omitempty"`
+	// add and install missing dependencies found in DependencyRepos when updating. installDeps can
+	// be set from the cli without changing the config
+	InstallDependencies bool `json:",omitempty"`
+	installDeps         bool
 	// number of threads to use for network and disk io tasks. (default: 2 and 128 respectively)
 	// this is an advanved option, use with care
 	NetTasksCfg  int `json:"NetTasks,omitempty"`
 	DiskTasksCfg int `json:"DiskTasks,omitempty"`
 	// copy of NetTasks and DiskTasks, keeping the original values when saving config
 	netTasks, diskTasks int
+	// number of times to retry failed requests (default: 3), set to -1 to disable retries
+	RetriesCfg int `json:"Retries,omitempty"`
+	retries    int
+	httpClient *http.Client
+	// number of previous versions of each addon kept in AddonsDir for rollback (default: 2), set to
+	// -1 to disable
+	GenerationsCfg int `json:"Generations,omitempty"`
+	generations    int
+	// github personal access token, raises the api rate limit from 60 to 5000 requests an hour.
+	// $GITHUB_TOKEN is used if omitted
+	GithubToken string `json:",omitempty"`
+	githubToken string
+	// curseforge api key, required for CfRel addons. $CURSEFORGE_API_KEY is used if omitted
+	CurseForgeApiKey string `json:",omitempty"`
+	curseforgeApiKey string
+	// wago addons api key, required for WgRel addons. $WAGO_API_KEY is used if omitted
+	WagoApiKey string `json:",omitempty"`
+	wagoApiKey string
 	// cache data on disk for dev, omit or set to "" to skip caching
 	CacheDir  string `json:",omitempty"`
 	cacheRoot *os.Root
@@ -35,9 +70,11 @@ type AddonManager struct {
 
 func newAddonManager() *AddonManager {
 	return &AddonManager{
-		Addons:          []*Addon{},
+		Installation: Installation{
+			Addons:     []*Addon{},
+			UpdateInfo: map[string]*AddonUpdateInfo{},
+		},
 		UnmanagedAddons: []string{},
-		UpdateInfo:      map[string]*AddonUpdateInfo{},
 	}
 }
 
@@ -59,18 +96,25 @@ func LoadAddonCfg(filename string) (*AddonManager, error) {
 }
 
 func (am *AddonManager) initialize() error {
-	// rebuild updateInfo with only currently tracked addons
-	prevUpdateInfo := am.UpdateInfo
-	am.UpdateInfo = make(map[string]*AddonUpdateInfo, len(am.Addons))
+	if err := validConflictPolicy(am.FolderConflicts); err != nil {
+		return err
+	}
+	if err := am.Installation.initialize(am.CacheDir, true); err != nil {
+		return err
+	}
 
-	for _, addon := range am.Addons {
-		if _, ok := am.UpdateInfo[addon.Name]; ok {
-			return fmt.Errorf("duplicate addon found: %v", addon.Name)
+	names := map[string]bool{strings.ToLower(am.displayName()): true}
+	for _, inst := range am.Installations {
+		if inst.Name == "" {
+			return fmt.Errorf("installation missing Name")
+		} else if names[strings.ToLower(inst.Name)] {
+			return fmt.Errorf("duplicate installation found: %v", inst.Name)
 		}
-		if err := am.initializeAddon(addon, prevUpdateInfo[addon.Name]); err != nil {
-			return fmt.Errorf("error loading addon %v: %w", addon.Name, err)
+		names[strings.ToLower(inst.Name)] = true
+
+		if err := inst.initialize(am.CacheDir, false); err != nil {
+			return fmt.Errorf("error loading installation %v: %w", inst.Name, err)
 		}
-		am.UpdateInfo[addon.Name] = addon.AddonUpdateInfo
 	}
 
 	am.netTasks, am.diskTasks = am.NetTasksCfg, am.DiskTasksCfg
@@ -80,6 +124,20 @@ func (am *AddonManager) initialize() error {
 	if am.DiskTasksCfg <= 0 {
 		am.DiskTasksCfg, am.diskTasks = 0, DefaultDiskTasks
 	}
+	switch am.retries = am.RetriesCfg; {
+	case am.RetriesCfg == 0:
+		am.retries = DefaultRetries
+	case am.RetriesCfg < 0:
+		am.RetriesCfg, am.retries = -1, 0
+	}
+	switch am.generations = am.GenerationsCfg; {
+	case am.GenerationsCfg == 0:
+		am.generations = DefaultGenerations
+	case am.GenerationsCfg < 0:
+		am.GenerationsCfg, am.generations = -1, 0
+	}
+	am.httpClient = newHttpClient()
+	am.installDeps = am.InstallDependencies
 
 	// create cache dir if provided
 	if am.CacheDir != "" {
@@ -90,67 +148,151 @@ func (am *AddonManager) initialize() error {
 		}
 	}
 
+	am.githubToken = am.GithubToken
+	if am.githubToken == "" {
+		am.githubToken = os.Getenv("GITHUB_TOKEN")
+	}
+	am.curseforgeApiKey = am.CurseForgeApiKey
+	if am.curseforgeApiKey == "" {
+		am.curseforgeApiKey = os.Getenv("CURSEFORGE_API_KEY")
+	}
+	am.wagoApiKey = am.WagoApiKey
+	if am.wagoApiKey == "" {
+		am.wagoApiKey = os.Getenv("WAGO_API_KEY")
+	}
+
 	return nil
 }
 
-func (am *AddonManager) initializeAddon(addon *Addon, lastUpdateInfo *AddonUpdateInfo) error {
-	if addon.RelType >= GhEnd {
-		return fmt.Errorf("unknown release type for addon %v: %v", addon.Name, addon.RelType)
+// installs returns every installation, the default installation is omitted if it is unused
+func (am *AddonManager) installs() []*Installation {
+	installs := make([]*Installation, 0, len(am.Installations)+1)
+	if len(am.Addons) != 0 || len(am.Installations) == 0 {
+		installs = append(installs, &am.Installation)
 	}
 
-	// // convenience to skip addons with a leading -, ie "-PROJECT/ADDON" is skipped
-	// if addon.Name[0] == '-' {
-	// 	addon.Skip = true
-	// 	addon.Name = addon.Name[1:]
-	// }
+	return append(installs, am.Installations...)
+}
+
+// findInstall looks up an installation by name, case-insensitive
+func (am *AddonManager) findInstall(name string) (*Installation, error) {
+	if name == "" || strings.EqualFold(am.displayName(), name) {
+		return &am.Installation, nil
+	}
 
-	// update projName and shortname
-	// addon.Name = "PROJECT/ADDON"; projName, shortName = "PROJECT/", "ADDON"
-	idx := strings.LastIndexByte(addon.Name, '/')
-	if idx <= 0 || idx == len(addon.Name)-1 {
-		return fmt.Errorf("addon name not formatted correctly: expected PROJECT/ADDON, found %v", addon.Name)
+	idx := slices.IndexFunc(am.Installations, func(inst *Installation) bool { return strings.EqualFold(inst.Name, name) })
+	if idx == -1 {
+		return nil, fmt.Errorf("installation %v not found", name)
 	}
-	addon.projName = addon.Name[:idx+1]
-	addon.shortName = addon.Name[idx+1:]
+	return am.Installations[idx], nil
+}
 
-	// set AddonUpdateInfo, creating it if not found
-	if lastUpdateInfo == nil {
-		lastUpdateInfo = &AddonUpdateInfo{}
+// selectAddons returns the addons matching names from installs, or all addons if names is empty.
+// a name can match an addon in each installation
+func (am *AddonManager) selectAddons(installs []*Installation, names []string) ([]*Addon, error) {
+	addons := []*Addon{}
+	if len(names) == 0 {
+		for _, inst := range installs {
+			addons = append(addons, inst.Addons...)
+		}
+		return addons, nil
 	}
-	addon.AddonUpdateInfo = lastUpdateInfo
 
-	// populate addon.{include,exclude}Dirs from Dirs
-	// dirs starting with '-' are excluded
-	for i, dir := range addon.Dirs {
-		// ensure dir names have a trailing '/'
-		if dir[len(dir)-1] != '/' {
-			dir += "/"
-			addon.Dirs[i] = dir
+	for _, name := range names {
+		found := false
+		for _, inst := range installs {
+			addon, err := inst.findAddon(name)
+			if errors.Is(err, errAddonNotFound) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			found = true
+			if !slices.Contains(addons, addon) {
+				addons = append(addons, addon)
+			}
 		}
 
-		if dir[0] == '-' {
-			addon.excludeDirs = append(addon.excludeDirs, dir[1:])
-		} else {
-			addon.includeDirs = append(addon.includeDirs, dir)
+		if !found {
+			return nil, fmt.Errorf("%w: %v", errAddonNotFound, name)
 		}
 	}
 
-	return nil
+	return addons, nil
+}
+
+// groupByInstall splits addons by installation, in the order installations are configured
+func (am *AddonManager) groupByInstall(addons []*Addon) iter.Seq2[*Installation, []*Addon] {
+	return func(yield func(*Installation, []*Addon) bool) {
+		for _, inst := range am.installs() {
+			instAddons := slices.DeleteFunc(slices.Clone(addons), func(a *Addon) bool { return a.install != inst })
+			if len(instAddons) != 0 && !yield(inst, instAddons) {
+				return
+			}
+		}
+	}
+}
+
+// ProbeAddon looks up the latest release of a new addon without adding it to inst, picking a
+// release type that works unless addon.RelType is set to tags. returns the top-level dirs of the
+// release's archive
+func (am *AddonManager) ProbeAddon(ctx context.Context, inst *Installation, addon *Addon) ([]string, error) {
+	if err := inst.initializeAddon(addon, nil); err != nil {
+		return nil, err
+	}
+
+	statuses, _, err := am.runAddonTasks(ctx, inst, []*Addon{addon}, nil, (*Addon).probe)
+	if err != nil {
+		return nil, err
+	} else if statuses[0].err != nil {
+		return nil, statuses[0].err
+	}
+
+	return statuses[0].zipDirs, nil
+}
+
+// RemoveAddon uninstalls addon and stops tracking it. the folders of addon are deleted unless
+// keepFiles is set, folders shared with other addons are kept
+func (am *AddonManager) RemoveAddon(addon *Addon, keepFiles bool) error {
+	return addon.install.uninstallAddon(addon, keepFiles)
+}
+
+// RollbackAddon reinstalls a previous version of addon kept when it was updated, generation id or
+// the latest previous version if id is 0
+func (am *AddonManager) RollbackAddon(ctx context.Context, addon *Addon, id int) error {
+	rollback := func(a *Addon, ctx context.Context) *addonUpdateStatus { return a.rollback(ctx, id) }
+	statuses, _, err := am.runAddonTasks(ctx, addon.install, []*Addon{addon}, nil, rollback)
+	if err != nil {
+		return err
+	}
+
+	return statuses[0].err
 }
 
-func (am *AddonManager) UpdateAddons() {
+// runAddonTasks runs task concurrently for each addon of inst, printing the logs of each addon in
+// order. returns the status of every task (in completion order) and the total execution time. once
+// ctx is cancelled no new tasks are started, tasks already running are expected to stop on their own
+func (am *AddonManager) runAddonTasks(ctx context.Context, inst *Installation, addons []*Addon, downloads *downloadCache, task func(*Addon, context.Context) *addonUpdateStatus) ([]*addonUpdateStatus, time.Duration, error) {
+	addonsRoot, err := inst.openAddonsDir()
+	if err != nil {
+		return nil, 0, err
+	}
+	inst.resolveInterface()
+	owners := newFolderOwners(inst.Addons, am.FolderConflicts)
+
 	netTasks, netCancel := spawnTaskPool(am.netTasks, am.netTasks)
 	defer netCancel()
 	diskTasks, diskCancel := spawnTaskPool(am.diskTasks, 12)
 	defer diskCancel()
-	updateTasks, updateRes, updateCancel := spawnTaskResPool[*addonUpdateStatus](am.netTasks*2, len(am.Addons))
+	updateTasks, updateRes, updateCancel := spawnTaskResPool[*addonUpdateStatus](am.netTasks*2, len(addons))
 	defer updateCancel()
 
 	bufPool := sync.Pool{New: func() any { return &bytes.Buffer{} }}
-	logsCh := make(chan chan string, len(am.Addons))
+	logsCh := make(chan chan string, len(addons))
 
 	start := time.Now()
-	for _, addon := range am.Addons {
+	for _, addon := range addons {
 		logs := make(chan string, 8)
 		logsCh <- logs
 
@@ -158,11 +300,33 @@ func (am *AddonManager) UpdateAddons() {
 			defer close(logs)
 			buf := bufPool.Get().(*bytes.Buffer)
 			defer func() { buf.Reset(); bufPool.Put(buf) }()
-			addon.addonSharedState = &addonSharedState{buf, am.cacheRoot, netTasks, diskTasks, logs}
+			addon.addonSharedState = &addonSharedState{
+				buf:              buf,
+				cacheDir:         am.cacheRoot,
+				addonsDir:        addonsRoot,
+				client:           am.httpClient,
+				retries:          am.retries,
+				githubToken:      am.githubToken,
+				curseforgeApiKey: am.curseforgeApiKey,
+				wagoApiKey:       am.wagoApiKey,
+				validators:       map[string]*httpValidators{},
+				downloads:        downloads,
+				owners:           owners,
+				generations:      am.generations,
+				netTasks:         netTasks,
+				diskTasks:        diskTasks,
+				logs:             logs,
+			}
 			defer func() { addon.addonSharedState = nil }()
+			defer downloads.done(addon.Name)
+
+			if err := ctx.Err(); err != nil {
+				addon.Logf("%v\n", tcYellow("interrupted"))
+				return &addonUpdateStatus{addon: addon, err: err}
+			}
 
 			start := time.Now()
-			status := addon.update()
+			status := task(addon, ctx)
 			status.execTime = time.Since(start)
 			// addon.Logf("updated in %v\n", status.execTime)
 			return status
@@ -183,14 +347,59 @@ func (am *AddonManager) UpdateAddons() {
 		}
 	}()
 
-	addonExecSum := time.Duration(0)
+	statuses := make([]*addonUpdateStatus, 0, len(addons))
 	for status := range updateRes {
-		am.UpdateInfo[status.addon.Name] = status.addon.AddonUpdateInfo
-		addonExecSum += status.execTime
+		statuses = append(statuses, status)
 	}
 	execTime := time.Since(start)
 	logTasksWg.Wait()
 
+	return statuses, execTime, nil
+}
+
+// UpdateAddons downloads and extracts any available updates for addons. returns an error if any
+// addon failed to update or ctx was cancelled
+func (am *AddonManager) UpdateAddons(ctx context.Context, addons []*Addon) error {
+	downloads := newDownloadCache(addons)
+	multiInstall := len(am.installs()) > 1
+
+	failed, total := 0, len(addons)
+	errs := []error{}
+	execTime, addonExecSum := time.Duration(0), time.Duration(0)
+	for inst, instAddons := range am.groupByInstall(addons) {
+		if multiInstall {
+			fmt.Printf("[%v %v]\n\n", tcDim("Installation"), tcCyan(inst.displayName()))
+		}
+
+		// newly added dependencies are installed in further rounds until none are missing. addons
+		// are only added once, so dependency cycles cannot loop forever
+		for len(instAddons) != 0 {
+			statuses, instExecTime, err := am.runAddonTasks(ctx, inst, instAddons, downloads, (*Addon).update)
+			if err != nil {
+				failed += len(instAddons)
+				errs = append(errs, fmt.Errorf("installation %v: %w", inst.displayName(), err))
+				break
+			}
+
+			execTime += instExecTime
+			for _, status := range statuses {
+				inst.UpdateInfo[status.addon.Name] = status.addon.AddonUpdateInfo
+				addonExecSum += status.execTime
+				if status.err != nil {
+					failed++
+				}
+			}
+
+			if ctx.Err() != nil {
+				break
+			}
+			if instAddons, err = am.resolveDependencies(inst, am.installDeps); err != nil {
+				errs = append(errs, fmt.Errorf("installation %v: %w", inst.displayName(), err))
+			}
+			total += len(instAddons)
+		}
+	}
+
 	fmt.Printf("[%v]\n", tcDim("Unmanaged Addons"))
 	for _, addon := range am.UnmanagedAddons {
 		// https://example.com/wow/addonA => url, name = "https://example.com/wow", "addonA"
@@ -205,6 +414,90 @@ func (am *AddonManager) UpdateAddons() {
 	fmt.Println()
 
 	fmt.Printf("updated addons in %v (total: %v)\n", execTime, addonExecSum)
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("update interrupted: %w", err)
+	} else if failed > 0 {
+		errs = append(errs, fmt.Errorf("%v of %v addons failed to update", failed, total))
+	}
+	return errors.Join(errs...)
+}
+
+// CheckAddons looks for available updates without downloading them or modifying any
+// AddonUpdateInfo. returns the number of addons with pending updates, excluding skipped addons, and
+// an error if any addon could not be checked
+func (am *AddonManager) CheckAddons(ctx context.Context, addons []*Addon) (int, error) {
+	multiInstall := len(am.installs()) > 1
+
+	statuses := make([]*addonUpdateStatus, 0, len(addons))
+	errs := []error{}
+	execTime := time.Duration(0)
+	for inst, instAddons := range am.groupByInstall(addons) {
+		if multiInstall {
+			fmt.Printf("[%v %v]\n\n", tcDim("Installation"), tcCyan(inst.displayName()))
+		}
+
+		instStatuses, instExecTime, err := am.runAddonTasks(ctx, inst, instAddons, nil, (*Addon).check)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("installation %v: %w", inst.displayName(), err))
+			for _, addon := range instAddons {
+				instStatuses = append(instStatuses, &addonUpdateStatus{addon: addon, err: err})
+			}
+		}
+		statuses = append(statuses, instStatuses...)
+		execTime += instExecTime
+	}
+
+	// report in config order, statuses are in completion order
+	slices.SortFunc(statuses, func(a, b *addonUpdateStatus) int {
+		return slices.Index(addons, a.addon) - slices.Index(addons, b.addon)
+	})
+
+	pending, failed := 0, 0
+	fmt.Printf("[%v]\n", tcDim("Available Updates"))
+	for _, status := range statuses {
+		addon, asset := status.addon, status.asset
+		if status.err != nil {
+			failed++
+			continue
+		} else if !status.hasUpdate && status.newer == "" {
+			continue
+		}
+
+		install := ""
+		if multiInstall {
+			install = tcDim(addon.install.displayName() + ": ")
+		}
+		if !status.hasUpdate {
+			// up to date with its pin, but newer versions are available
+			fmt.Printf("%v%v%v %v on %v%v\n", install, tcDim(addon.projName), tcCyan(addon.shortName), tcGreen(addon.Version),
+				fmtUpdateInfo(addon.RelType, addon.UpdatedOn, addon.RefSha), addon.pinInfo(status.newer))
+			continue
+		}
+
+		held := addon.pinInfo(status.newer)
+		if addon.Skip {
+			held += tcDim(" (held)")
+		} else if !addon.compatible(asset.Interface) && addon.Compat == CompatRefuse {
+			// update would refuse to install it
+			held += tcYellow(fmt.Sprintf(" (refused, supports interface %v)", asset.Interface))
+		} else {
+			pending++
+		}
+		fmt.Printf("%v%v%v %v on %v -> %v on %v%v\n", install, tcDim(addon.projName), tcCyan(addon.shortName),
+			tcGreen(addon.Version), fmtUpdateInfo(addon.RelType, addon.UpdatedOn, addon.RefSha),
+			tcGreen(asset.Version), fmtUpdateInfo(asset.RelType, asset.UpdatedAt, asset.RefSha), held)
+	}
+	fmt.Println()
+
+	fmt.Printf("checked addons in %v, %v updates available\n", execTime, pending)
+
+	if err := ctx.Err(); err != nil {
+		return pending, fmt.Errorf("check interrupted: %w", err)
+	} else if failed > 0 {
+		errs = append(errs, fmt.Errorf("%v of %v addons failed to check for updates", failed, len(addons)))
+	}
+	return pending, errors.Join(errs...)
 }
 
 func (am *AddonManager) SaveAddonCfg(filename string) error {
@@ -225,19 +518,10 @@ func (am *AddonManager) String() string {
 	buf := &strings.Builder{}
 
 	fmt.Fprintln(buf, "CacheDir:", am.CacheDir)
+	fmt.Fprintln(buf)
 
-	for _, addon := range am.Addons {
-		fmt.Fprintf(buf, "%v%v\n", tcDim(addon.projName), tcCyan(addon.shortName))
-		fmt.Fprintln(buf, "  Dirs:           ", addon.Dirs)
-		fmt.Fprintln(buf, "  RelType:        ", addon.RelType)
-		fmt.Fprintln(buf, "  includeDirs:    ", addon.includeDirs)
-		fmt.Fprintln(buf, "  excludeDirs:    ", addon.excludeDirs)
-		fmt.Fprintln(buf, "  addonUpdateInfo:")
-		fmt.Fprintln(buf, "    Version:      ", addon.AddonUpdateInfo.Version)
-		fmt.Fprintln(buf, "    UpdatedOn:    ", addon.AddonUpdateInfo.UpdatedOn)
-		fmt.Fprintln(buf, "    RefSha:       ", addon.AddonUpdateInfo.RefSha)
-		fmt.Fprintln(buf, "    ExtractedDirs:", addon.AddonUpdateInfo.ExtractedDirs)
-		fmt.Fprintln(buf, "")
+	for _, inst := range am.installs() {
+		fmt.Fprint(buf, inst)
 	}
 
 	for addon, url := range am.UnmanagedAddons {
@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestAddonManager_initializeAddonManager(t *testing.T) {
@@ -27,49 +34,53 @@ func TestAddonManager_initializeAddonManager(t *testing.T) {
 		}, {
 			name: "initialize addon manager with addons",
 			input: &AddonManager{
-				Addons: []*Addon{
-					{
-						Name:    "proj/addon1",
-						RelType: GhRel,
-						Dirs:    []string{"dir1", "-dir2", "dir3/"},
+				Installation: Installation{
+					Addons: []*Addon{
+						{
+							Name:    "proj/addon1",
+							RelType: GhRel,
+							Dirs:    []string{"dir1", "-dir2", "dir3/"},
+						},
+						{
+							Name:    "proj/addon2",
+							RelType: GhRel,
+							Skip:    true,
+						},
 					},
-					{
-						Name:    "proj/addon2",
-						RelType: GhRel,
-						Skip:    true,
-					},
-				},
-				UpdateInfo: map[string]*AddonUpdateInfo{
-					"proj/addon1": expectedUpdateInfo()["proj/addon1"],
-					"not/exists": {
-						RefSha: "sha-123456",
+					UpdateInfo: map[string]*AddonUpdateInfo{
+						"proj/addon1": expectedUpdateInfo()["proj/addon1"],
+						"not/exists": {
+							RefSha: "sha-123456",
+						},
 					},
 				},
 				CacheDir: "",
 			},
 			expected: &AddonManager{
-				Addons: []*Addon{
-					{
-						Name:            "proj/addon1",
-						RelType:         GhRel,
-						Dirs:            []string{"dir1/", "-dir2/", "dir3/"},
-						excludeDirs:     []string{"dir2/"},
-						includeDirs:     []string{"dir1/", "dir3/"},
-						projName:        "proj/",
-						shortName:       "addon1",
-						AddonUpdateInfo: expectedUpdateInfo()["proj/addon1"],
-					},
-					{
-						Name:            "proj/addon2",
-						RelType:         GhRel,
-						Skip:            true,
-						projName:        "proj/",
-						shortName:       "addon2",
-						AddonUpdateInfo: expectedUpdateInfo()["proj/addon2"],
+				Installation: Installation{
+					Addons: []*Addon{
+						{
+							Name:            "proj/addon1",
+							RelType:         GhRel,
+							Dirs:            []string{"dir1/", "-dir2/", "dir3/"},
+							excludeDirs:     []string{"dir2/"},
+							includeDirs:     []string{"dir1/", "dir3/"},
+							projName:        "proj/",
+							shortName:       "addon1",
+							AddonUpdateInfo: expectedUpdateInfo()["proj/addon1"],
+						},
+						{
+							Name:            "proj/addon2",
+							RelType:         GhRel,
+							Skip:            true,
+							projName:        "proj/",
+							shortName:       "addon2",
+							AddonUpdateInfo: expectedUpdateInfo()["proj/addon2"],
+						},
 					},
+					UpdateInfo: expectedUpdateInfo(),
 				},
-				UpdateInfo: expectedUpdateInfo(),
-				CacheDir:   "",
+				CacheDir: "",
 			},
 		},
 	}
@@ -92,7 +103,7 @@ func TestAddonManager_initializeAddonManager(t *testing.T) {
 			// updateInfo since it is checked above
 			testEq(t, "updateInfo and addon count", len(i.UpdateInfo), len(e.Addons))
 			testEq(t, "updateInfo length", len(i.UpdateInfo), len(e.UpdateInfo))
-			// Addon.UpdateInfo should be a pointer to AddonManager.UpdateInfo
+			// Addon.UpdateInfo should be a pointer to Installation.UpdateInfo
 			for _, addon := range i.Addons {
 				testEqPtr(t, "updateInfo ptr "+addon.Name, addon.AddonUpdateInfo, i.UpdateInfo[addon.Name])
 			}
@@ -242,6 +253,307 @@ func TestAddonManager_initializeAddon_fail(t *testing.T) {
 	}
 }
 
+func TestAddonManager_initialize_flavor(t *testing.T) {
+	am := newAddonManager()
+	am.Flavor = FlavorCata
+	am.Addons = []*Addon{{Name: "proj/addon"}}
+	if err := am.initialize(); err != nil {
+		t.Fatalf("error initializing addon manager: %v", err)
+	}
+	testEq(t, "addon.flavor", am.Addons[0].flavor, FlavorCata)
+
+	am = newAddonManager()
+	am.Flavor = "retail"
+	if err := am.initialize(); err == nil {
+		t.Errorf("expected error initializing addon manager with unknown flavor")
+	}
+}
+
+func TestAddonManager_initialize_addonsDir(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		addonsDir string
+		cacheDir  string
+		expected  string
+	}{
+		{"default to working dir", "", "", "."},
+		{"default to cache dir in dev", "", cacheDir, cacheDir + "/addons"},
+		{"configured addons dir", "wow/AddOns", cacheDir, "wow/AddOns"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			am := newAddonManager()
+			am.AddonsDir, am.CacheDir = tc.addonsDir, tc.cacheDir
+			if err := am.initialize(); err != nil {
+				t.Errorf("error initializing addon manager: %v", err)
+				return
+			}
+
+			testEq(t, "addonsDir", am.addonsDir, tc.expected)
+			// config value should be saved as is
+			testEq(t, "AddonsDir", am.AddonsDir, tc.addonsDir)
+		})
+	}
+}
+
+func TestAddonManager_initialize_installations(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	am := newAddonManager()
+	am.CacheDir = cacheDir
+	am.Addons = []*Addon{{Name: "proj/addon"}}
+	am.Installations = []*Installation{
+		{
+			Name:   "classic",
+			Flavor: FlavorClassic,
+			Addons: []*Addon{{Name: "proj/addon"}, {Name: "proj/other"}},
+			UpdateInfo: map[string]*AddonUpdateInfo{
+				"proj/addon": {Version: "v1"},
+			},
+		},
+		{Name: "ptr", AddonsDir: "wow/_ptr_/Interface/AddOns"},
+	}
+	if err := am.initialize(); err != nil {
+		t.Fatalf("error initializing addon manager: %v", err)
+	}
+
+	classic, ptr := am.Installations[0], am.Installations[1]
+	testEq(t, "installs", len(am.installs()), 3)
+	testEq(t, "default addonsDir", am.addonsDir, cacheDir+"/addons")
+	testEq(t, "classic addonsDir", classic.addonsDir, cacheDir+"/addons-classic")
+	testEq(t, "ptr addonsDir", ptr.addonsDir, "wow/_ptr_/Interface/AddOns")
+
+	// the same addon is tracked separately in each installation
+	addon, classicAddon := am.Addons[0], classic.Addons[0]
+	testEq(t, "default flavor", addon.flavor, "")
+	testEq(t, "classic flavor", classicAddon.flavor, FlavorClassic)
+	testEqPtr(t, "default install", addon.install, &am.Installation)
+	testEqPtr(t, "classic install", classicAddon.install, classic)
+	testEqPtr(t, "default updateInfo", addon.AddonUpdateInfo, am.UpdateInfo["proj/addon"])
+	testEqPtr(t, "classic updateInfo", classicAddon.AddonUpdateInfo, classic.UpdateInfo["proj/addon"])
+	testEq(t, "default version", addon.Version, "")
+	testEq(t, "classic version", classicAddon.Version, "v1")
+
+	inst, err := am.findInstall("CLASSIC")
+	if err == nil {
+		testEqPtr(t, "findInstall", inst, classic)
+	} else {
+		t.Errorf("error finding installation: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		cacheDir string
+		installs []*Installation
+	}{
+		{"missing name", cacheDir, []*Installation{{}}},
+		{"duplicate name", cacheDir, []*Installation{{Name: "ptr"}, {Name: "PTR"}}},
+		{"default name", cacheDir, []*Installation{{Name: "default"}}},
+		{"missing addons dir", "", []*Installation{{Name: "ptr"}}},
+		{"unknown flavor", cacheDir, []*Installation{{Name: "ptr", Flavor: "retail"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			am := newAddonManager()
+			am.CacheDir, am.Installations = tc.cacheDir, tc.installs
+			if err := am.initialize(); err == nil {
+				t.Errorf("expected error initializing addon manager")
+			}
+		})
+	}
+}
+
+func TestAddonManager_selectAddons(t *testing.T) {
+	am := newAddonManager()
+	am.Addons = []*Addon{{Name: "proj/addon"}}
+	am.Installations = []*Installation{
+		{Name: "classic", AddonsDir: ".", Addons: []*Addon{{Name: "proj/addon"}, {Name: "proj/other"}}},
+	}
+	if err := am.initialize(); err != nil {
+		t.Fatalf("error initializing addon manager: %v", err)
+	}
+	classic := am.Installations[0]
+
+	tests := []struct {
+		name     string
+		installs []*Installation
+		names    []string
+		expected []*Addon
+	}{
+		{"all addons", am.installs(), nil, []*Addon{am.Addons[0], classic.Addons[0], classic.Addons[1]}},
+		{"name in every install", am.installs(), []string{"addon"}, []*Addon{am.Addons[0], classic.Addons[0]}},
+		{"single install", []*Installation{classic}, []string{"addon", "other"}, classic.Addons},
+		{"not found", []*Installation{&am.Installation}, []string{"other"}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			addons, err := am.selectAddons(tc.installs, tc.names)
+			if tc.expected == nil {
+				if !errors.Is(err, errAddonNotFound) {
+					t.Errorf("expected errAddonNotFound, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("error selecting addons: %v", err)
+				return
+			}
+			if testEq(t, "addons length", len(addons), len(tc.expected)) {
+				for i := range addons {
+					testEqPtr(t, "addon", addons[i], tc.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAddonManager_findAddon(t *testing.T) {
+	am := newAddonManager()
+	am.Addons = []*Addon{{Name: "proj1/addon"}, {Name: "proj2/addon"}, {Name: "proj2/other"}}
+	if err := am.initialize(); err != nil {
+		t.Fatalf("error initializing addon manager: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected *Addon
+	}{
+		{"full name", "proj2/addon", am.Addons[1]},
+		{"full name case-insensitive", "PROJ1/Addon", am.Addons[0]},
+		{"short name", "other", am.Addons[2]},
+		{"ambiguous short name", "addon", nil},
+		{"not found", "missing", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			addon, err := am.findAddon(tc.input)
+			if tc.expected == nil {
+				if err == nil {
+					t.Errorf("expected error finding addon %v", tc.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("error finding addon: %v", err)
+				return
+			}
+			testEqPtr(t, "addon", addon, tc.expected)
+		})
+	}
+}
+
+func TestAddonManager_runAddonTasks_cancelled(t *testing.T) {
+	am := newAddonManager()
+	am.AddonsDir = t.TempDir()
+	am.Addons = []*Addon{{Name: "proj/addon1"}, {Name: "proj/addon2"}}
+	if err := am.initialize(); err != nil {
+		t.Fatalf("error initializing addon manager: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	ran := atomic.Int32{}
+	statuses, _, err := am.runAddonTasks(ctx, &am.Installation, am.Addons, nil, func(a *Addon, ctx context.Context) *addonUpdateStatus {
+		ran.Add(1)
+		return &addonUpdateStatus{addon: a}
+	})
+	if err != nil {
+		t.Fatalf("error running addon tasks: %v", err)
+	}
+
+	testEq(t, "tasks run", ran.Load(), 0)
+	if testEq(t, "statuses", len(statuses), len(am.Addons)) {
+		for _, status := range statuses {
+			testEq(t, "status.err "+status.addon.Name, errors.Is(status.err, context.Canceled), true)
+		}
+	}
+}
+
+func TestAddonManager_CheckAddons_refused(t *testing.T) {
+	const relJson = `{"tag_name": "v2.0.0", "assets": [
+		{"name": "addon-v2.0.0.zip", "content_type": "application/zip", "updated_at": "2024-06-01T00:00:00Z"},
+		{"name": "release.json", "content_type": "application/json"}
+	]}`
+	const manifestJson = `{"releases": [
+		{"version": "2.0.0", "filename": "addon-v2.0.0.zip", "metadata": [{"flavor": "mainline", "interface": 100207}]}
+	]}`
+
+	cacheDir := t.TempDir()
+	for _, name := range []string{"refused", "warned"} {
+		testWriteFile(t, cacheDir+"/"+name+"-rel.json", relJson)
+		testWriteFile(t, cacheDir+"/"+name+"-addonRel.json", manifestJson)
+	}
+
+	am := newAddonManager()
+	am.CacheDir = cacheDir
+	am.AddonsDir = t.TempDir()
+	am.Interface = 110105
+	am.Addons = []*Addon{{Name: "proj/refused", Compat: CompatRefuse}, {Name: "proj/warned"}}
+	if err := am.initialize(); err != nil {
+		t.Fatalf("error initializing addon manager: %v", err)
+	}
+
+	// the refused update is never installed, so it is not pending
+	pending, err := am.CheckAddons(t.Context(), am.Addons)
+	if err != nil {
+		t.Fatalf("error checking addons: %v", err)
+	}
+	testEq(t, "pending", pending, 1)
+}
+
+func TestAddonManager_UpdateAddons_flakyServer(t *testing.T) {
+	const relJson = `{"tag_name": "v1.0.0", "published_at": "2024-06-01T00:00:00Z",
+		"assets": [{"name": "addon-v1.0.0.zip", "browser_download_url": "http://%v/addon-v1.0.0.zip"}]}`
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/repos/proj/slow/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		// keep the only net worker busy until the failing addons have queued their requests
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(w, relJson, r.Host)
+	})
+	mux.HandleFunc("/addon-v1.0.0.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testZip(t, testZipEntry{name: "Slow/Slow.toc", data: "## Title: Slow"}))
+	})
+	mux.HandleFunc("/api/repos/proj/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	am := newAddonManager()
+	am.AddonsDir = t.TempDir()
+	// more retry logs than an addon's log buffer holds, with a single net worker shared by all addons
+	am.NetTasksCfg, am.RetriesCfg = 1, 12
+	for _, name := range []string{"proj/slow", "proj/flaky1", "proj/flaky2"} {
+		am.Addons = append(am.Addons, &Addon{Name: name, RelType: GtRel, ApiUrl: srv.URL + "/api"})
+	}
+	if err := am.initialize(); err != nil {
+		t.Fatalf("error initializing addon manager: %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- am.UpdateAddons(t.Context(), am.Addons) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected error updating failing addons")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("updating addons against a flaky server hung")
+	}
+	testEq(t, "Slow/Slow.toc", testReadFile(t, am.AddonsDir+"/Slow/Slow.toc"), "## Title: Slow")
+}
+
 // test data
 
 func initializeAddonFailCases() []struct {
@@ -282,6 +594,32 @@ func initializeAddonFailCases() []struct {
 				Name:    "name/",
 				RelType: GhRel,
 			},
+		}, {
+			name: "unknown compat policy",
+			input: &Addon{
+				Name:   "proj/name",
+				Compat: "skip",
+			},
+		}, {
+			name: "api url without scheme",
+			input: &Addon{
+				Name:    "proj/name",
+				RelType: GlRel,
+				ApiUrl:  "gitlab.example.com/api/v4",
+			},
+		}, {
+			name: "curseforge project id not a number",
+			input: &Addon{
+				Name:    "curseforge/addon",
+				RelType: CfRel,
+			},
+		}, {
+			name: "unknown channel",
+			input: &Addon{
+				Name:    "curseforge/1234",
+				RelType: CfRel,
+				Channel: "nightly",
+			},
 		},
 	}
 }
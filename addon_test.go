@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestAddon_findTaggedRel(t *testing.T) {
@@ -110,6 +117,67 @@ func TestAddon_findTaggedRel(t *testing.T) {
 	}
 }
 
+func TestAddon_findTaggedRel_flavor(t *testing.T) {
+	mkDlAsset := func(fileNm string) *downloadAsset {
+		return &downloadAsset{Name: fileNm, ContentType: "application/zip"}
+	}
+	ghRel := ghTaggedRel{
+		TagName: "v1.tag",
+		Assets: []*downloadAsset{
+			mkDlAsset("addon-v1.zip"),
+			mkDlAsset("addon-v1-classic.zip"),
+			mkDlAsset("addon-v1-bcc.zip"),
+			mkDlAsset("addon-v1-wrath.zip"),
+			mkDlAsset("addon-v1-cata.zip"),
+			mkDlAsset("addon-v1-mists.zip"),
+		},
+	}
+	relInfo := releaseInfo{[]release{
+		{"v1.0.0", "addon-v1.zip", []*releaseMetadata{{"mainline", 110002}}},
+		{"v1.0.0", "addon-v1-classic.zip", []*releaseMetadata{{"classic", 11505}}},
+		{"v1.0.0", "addon-v1-mists.zip", []*releaseMetadata{{"mists", 50500}, {"cata", 40402}}},
+	}}
+
+	tests := []struct {
+		flavor   string
+		relInfo  releaseInfo
+		expected string
+		ifaces   []int
+	}{
+		{"", releaseInfo{}, "addon-v1.zip", nil},
+		{FlavorMainline, releaseInfo{}, "addon-v1.zip", nil},
+		{FlavorClassic, releaseInfo{}, "addon-v1-classic.zip", nil},
+		{FlavorBcc, releaseInfo{}, "addon-v1-bcc.zip", nil},
+		{FlavorWrath, releaseInfo{}, "addon-v1-wrath.zip", nil},
+		{FlavorCata, releaseInfo{}, "addon-v1-cata.zip", nil},
+		{FlavorMists, releaseInfo{}, "addon-v1-mists.zip", nil},
+		{FlavorMainline, relInfo, "addon-v1.zip", []int{110002}},
+		{FlavorClassic, relInfo, "addon-v1-classic.zip", []int{11505}},
+		// release.json takes priority over asset names
+		{FlavorCata, relInfo, "addon-v1-mists.zip", []int{40402}},
+		// flavor not in release.json, fallback to asset names
+		{FlavorWrath, relInfo, "addon-v1-wrath.zip", nil},
+	}
+
+	for _, tc := range tests {
+		name := tc.flavor + " " + tc.expected
+		if len(tc.relInfo.Releases) != 0 {
+			name += " with release.json"
+		}
+		t.Run(name, func(t *testing.T) {
+			addon := &Addon{flavor: tc.flavor}
+
+			res, err := addon.findTaggedRel(&ghRel, &tc.relInfo)
+			if err != nil {
+				t.Errorf("error finding tagged release: %v", err)
+				return
+			}
+			testEq(t, "Name", res.Name, tc.expected)
+			testEqFunc(t, "Interface", res.Interface, tc.ifaces, slices.Equal)
+		})
+	}
+}
+
 func TestAddon_findTaggedRel_fail(t *testing.T) {
 	mkDlAsset := func(fileNm, contentType string) *downloadAsset {
 		return &downloadAsset{
@@ -188,3 +256,319 @@ func TestAddon_findTaggedRel_fail(t *testing.T) {
 		})
 	}
 }
+
+func TestAddon_check(t *testing.T) {
+	const relJson = `{
+		"tag_name": "v2.0.0",
+		"assets": [{
+			"name": "addon-v2.0.0.zip",
+			"size": 1024,
+			"browser_download_url": "https://example.invalid/addon-v2.0.0.zip",
+			"content_type": "application/zip",
+			"updated_at": "2024-06-01T00:00:00Z"
+		}]
+	}`
+	relDate := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		input     AddonUpdateInfo
+		skip      bool
+		hasUpdate bool
+	}{
+		{
+			name:      "update available",
+			input:     AddonUpdateInfo{Version: "v1.0.0", UpdatedOn: relDate.AddDate(0, -1, 0), ExtractedDirs: []string{"Addon"}},
+			hasUpdate: true,
+		}, {
+			name:      "update available for held addon",
+			input:     AddonUpdateInfo{Version: "v1.0.0", UpdatedOn: relDate.AddDate(0, -1, 0), ExtractedDirs: []string{"Addon"}},
+			skip:      true,
+			hasUpdate: true,
+		}, {
+			name:      "up to date",
+			input:     AddonUpdateInfo{Version: "v2.0.0", UpdatedOn: relDate, ExtractedDirs: []string{"Addon"}},
+			hasUpdate: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			testWriteFile(t, cacheDir+"/addon-rel.json", relJson)
+
+			updateInfo := tc.input
+			addon := &Addon{Name: "proj/addon", Skip: tc.skip, projName: "proj/", shortName: "addon", AddonUpdateInfo: &updateInfo}
+			testSharedState(t, addon, cacheDir, t.TempDir())
+
+			status := addon.check(t.Context())
+			if status.err != nil {
+				t.Errorf("error checking for update: %v", status.err)
+				return
+			}
+			testEq(t, "hasUpdate", status.hasUpdate, tc.hasUpdate)
+			testEq(t, "asset.Version", status.asset.Version, "v2.0.0")
+
+			// check should never modify update info or download the update
+			testEq(t, "Version", updateInfo.Version, tc.input.Version)
+			testEqFunc(t, "UpdatedOn", updateInfo.UpdatedOn, tc.input.UpdatedOn, time.Time.Equal)
+			testEqFunc(t, "ExtractedDirs", updateInfo.ExtractedDirs, tc.input.ExtractedDirs, slices.Equal)
+
+			entries, err := os.ReadDir(cacheDir)
+			if err != nil {
+				t.Fatalf("error reading cache dir: %v", err)
+			}
+			testEq(t, "cached files", len(entries), 1)
+		})
+	}
+}
+
+func TestAddon_findUpdate_pin(t *testing.T) {
+	const latestRelJson = `{"tag_name": "v2.0.0", "assets": [
+		{"name": "addon-v2.0.0.zip", "content_type": "application/zip", "updated_at": "2024-06-01T00:00:00Z"}
+	]}`
+	const pinnedRelJson = `{"tag_name": "v1.0.0", "assets": [
+		{"name": "addon-v1.0.0.zip", "content_type": "application/zip", "updated_at": "2024-05-01T00:00:00Z"}
+	]}`
+	const refJson = `[
+		{"ref": "refs/tags/30", "object": {"sha": "30abcdef"}},
+		{"ref": "refs/tags/31", "object": {"sha": "31abcdef"}}
+	]`
+	cacheDir := t.TempDir()
+	testWriteFile(t, cacheDir+"/addon-rel.json", latestRelJson)
+	testWriteFile(t, cacheDir+"/addon-rel-v1.0.0.json", pinnedRelJson)
+	testWriteFile(t, cacheDir+"/addon-rel-v2.0.0.json", latestRelJson)
+	testWriteFile(t, cacheDir+"/addon-ref.json", refJson)
+	latestDate := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		relType   GhRelType
+		pin       string
+		installed AddonUpdateInfo
+		version   string
+		hasUpdate bool
+		newer     string
+	}{
+		{"release downgrade", GhRel, "v1.0.0", AddonUpdateInfo{Version: "v2.0.0", UpdatedOn: latestDate}, "v1.0.0", true, "v2.0.0"},
+		{"release pinned to latest", GhRel, "v2.0.0", AddonUpdateInfo{Version: "v2.0.0", UpdatedOn: latestDate}, "v2.0.0", false, ""},
+		{"tag", GhTag, "30", AddonUpdateInfo{RefSha: "refs/tags/31"}, "30.zip", true, "31"},
+		{"ref sha", GhTag, "30abcde", AddonUpdateInfo{RefSha: "refs/tags/30"}, "30.zip", false, "31"},
+		{"tag pinned to latest", GhTag, "31", AddonUpdateInfo{RefSha: "refs/tags/31"}, "31.zip", false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			installed := tc.installed
+			addon := &Addon{Name: "proj/addon", RelType: tc.relType, Pin: tc.pin}
+			if err := newAddonManager().initializeAddon(addon, &installed); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			testSharedState(t, addon, cacheDir, t.TempDir())
+
+			status := addon.findUpdate(t.Context())
+			if status.err != nil {
+				t.Fatalf("error finding update: %v", status.err)
+			}
+			testEq(t, "Version", status.asset.Version, tc.version)
+			testEq(t, "hasUpdate", status.hasUpdate, tc.hasUpdate)
+			testEq(t, "newer", status.newer, tc.newer)
+		})
+	}
+
+	addon := &Addon{Name: "proj/addon", RelType: GhTag, Pin: "29"}
+	if err := newAddonManager().initializeAddon(addon, nil); err != nil {
+		t.Fatalf("error initializing addon: %v", err)
+	}
+	testSharedState(t, addon, cacheDir, t.TempDir())
+	if status := addon.findUpdate(t.Context()); status.err == nil {
+		t.Errorf("expected error finding missing pinned tag")
+	}
+}
+
+func TestAddon_probe(t *testing.T) {
+	const relJson = `{
+		"tag_name": "v2.0.0",
+		"assets": [{
+			"name": "addon-v2.0.0.zip",
+			"browser_download_url": "https://example.invalid/addon-v2.0.0.zip",
+			"content_type": "application/zip"
+		}]
+	}`
+	const refJson = `[{"ref": "refs/tags/31", "object": {"sha": "abc"}}]`
+
+	tests := []struct {
+		name     string
+		relType  GhRelType
+		cache    map[string]string
+		expected GhRelType
+	}{
+		{"release", GhRel, map[string]string{"addon-rel.json": relJson, "addon-ref.json": refJson}, GhRel},
+		{"fallback to tag", GhRel, map[string]string{"addon-rel.json": "not found", "addon-ref.json": refJson}, GhTag},
+		{"forced tag", GhTag, map[string]string{"addon-rel.json": relJson, "addon-ref.json": refJson}, GhTag},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			for name, data := range tc.cache {
+				testWriteFile(t, cacheDir+"/"+name, data)
+			}
+			zip := string(testZip(t,
+				testZipEntry{name: "README.md", data: "readme"},
+				testZipEntry{name: "Addon/Addon.toc", data: "toc"},
+				testZipEntry{name: "Addon_Options/Addon_Options.toc", data: "toc"},
+			))
+			testWriteFile(t, cacheDir+"/addon-addon-v2.0.0.zip", zip)
+			testWriteFile(t, cacheDir+"/addon-31.zip", zip)
+
+			addon := &Addon{Name: "proj/addon", RelType: tc.relType}
+			if err := newAddonManager().initializeAddon(addon, nil); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			testSharedState(t, addon, cacheDir, t.TempDir())
+
+			status := addon.probe(t.Context())
+			if status.err != nil {
+				t.Fatalf("error probing addon: %v", status.err)
+			}
+			testEq(t, "RelType", addon.RelType, tc.expected)
+			testEq(t, "asset.RelType", status.asset.RelType, tc.expected)
+			testEqFunc(t, "zipDirs", status.zipDirs, []string{"Addon", "Addon_Options"}, slices.Equal)
+		})
+	}
+}
+
+func TestAddon_extractZip(t *testing.T) {
+	addonsDir := t.TempDir()
+	testWriteFile(t, addonsDir+"/Old/Old.toc", "old")
+	testWriteFile(t, addonsDir+"/Unrelated/Unrelated.toc", "unrelated")
+
+	addon := &Addon{Name: "proj/addon", Dirs: []string{"-Other"}}
+	if err := newAddonManager().initializeAddon(addon, &AddonUpdateInfo{ExtractedDirs: []string{"Old"}}); err != nil {
+		t.Fatalf("error initializing addon: %v", err)
+	}
+	testSharedState(t, addon, t.TempDir(), addonsDir)
+	addon.buf.Write(testZip(t,
+		testZipEntry{name: "README.md", data: "readme"},
+		testZipEntry{name: "New/", mode: fs.ModeDir | 0755},
+		testZipEntry{name: "New/New.toc", data: "new"},
+		testZipEntry{name: "New/libs/lib.lua", data: "lib"},
+		testZipEntry{name: "Other/Other.toc", data: "other"},
+	))
+
+	extractedDirs, err := addon.extractZip(t.Context())
+	if err != nil {
+		t.Fatalf("error extracting zip: %v", err)
+	}
+
+	testEqFunc(t, "extractedDirs", extractedDirs, []string{"New"}, slices.Equal)
+	testEq(t, "New/New.toc", testReadFile(t, addonsDir+"/New/New.toc"), "new")
+	testEq(t, "New/libs/lib.lua", testReadFile(t, addonsDir+"/New/libs/lib.lua"), "lib")
+	testEq(t, "Old/Old.toc", testReadFile(t, addonsDir+"/Old/Old.toc"), "<missing>")
+	testEq(t, "Unrelated/Unrelated.toc", testReadFile(t, addonsDir+"/Unrelated/Unrelated.toc"), "unrelated")
+	testEq(t, "Other/Other.toc", testReadFile(t, addonsDir+"/Other/Other.toc"), "<missing>")
+	testEq(t, "README.md", testReadFile(t, addonsDir+"/README.md"), "<missing>")
+	// ExtractedDirs is only updated by the caller once the update succeeds
+	testEqFunc(t, "ExtractedDirs", addon.ExtractedDirs, []string{"Old"}, slices.Equal)
+}
+
+func TestAddon_extractZip_rollback(t *testing.T) {
+	addonsDir := t.TempDir()
+	testWriteFile(t, addonsDir+"/Addon/Addon.toc", "old")
+	testWriteFile(t, addonsDir+"/Addon/old.lua", "old")
+
+	addon := &Addon{Name: "proj/addon"}
+	if err := newAddonManager().initializeAddon(addon, &AddonUpdateInfo{ExtractedDirs: []string{"Addon"}}); err != nil {
+		t.Fatalf("error initializing addon: %v", err)
+	}
+	testSharedState(t, addon, t.TempDir(), addonsDir)
+	addon.buf.Write(testZip(t,
+		testZipEntry{name: "Addon/Addon.toc", data: "new"},
+		testZipEntry{name: "Addon/new.lua", data: "new", badCrc: true},
+	))
+
+	if _, err := addon.extractZip(t.Context()); err == nil {
+		t.Fatalf("expected error extracting corrupt zip")
+	}
+
+	testEq(t, "Addon/Addon.toc", testReadFile(t, addonsDir+"/Addon/Addon.toc"), "old")
+	testEq(t, "Addon/old.lua", testReadFile(t, addonsDir+"/Addon/old.lua"), "old")
+	testEq(t, "Addon/new.lua", testReadFile(t, addonsDir+"/Addon/new.lua"), "<missing>")
+	testEqFunc(t, "ExtractedDirs", addon.ExtractedDirs, []string{"Addon"}, slices.Equal)
+
+	staged, _ := os.ReadDir(addonsDir + "/" + stagingDir)
+	testEq(t, "staged dirs", len(staged), 0)
+}
+
+func TestAddon_extractZip_unsafe(t *testing.T) {
+	tests := []struct {
+		name  string
+		input testZipEntry
+	}{
+		{"parent dir", testZipEntry{name: "../evil.lua", data: "evil"}},
+		{"nested parent dir", testZipEntry{name: "../../evil.lua", data: "evil"}},
+		{"escape top-level dir", testZipEntry{name: "Addon/../../evil.lua", data: "evil"}},
+		{"escape into sibling dir", testZipEntry{name: "Addon/../Other/evil.lua", data: "evil"}},
+		{"absolute path", testZipEntry{name: "/tmp/evil.lua", data: "evil"}},
+		{"windows absolute path", testZipEntry{name: "C:/evil.lua", data: "evil"}},
+		{"backslash separators", testZipEntry{name: `Addon\..\..\evil.lua`, data: "evil"}},
+		{"current dir", testZipEntry{name: "Addon/./evil.lua", data: "evil"}},
+		{"empty path element", testZipEntry{name: "Addon//evil.lua", data: "evil"}},
+		{"symlink", testZipEntry{name: "Addon/evil.lua", data: "../../evil.lua", mode: fs.ModeSymlink | 0777}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// nest AddOns so entries escaping it are still inside the test dir
+			rootDir := t.TempDir()
+			addonsDir := rootDir + "/Interface/AddOns"
+			testWriteFile(t, addonsDir+"/Addon/Addon.toc", "old")
+
+			addon := &Addon{Name: "proj/addon"}
+			if err := newAddonManager().initializeAddon(addon, &AddonUpdateInfo{ExtractedDirs: []string{"Addon"}}); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			testSharedState(t, addon, t.TempDir(), addonsDir)
+			addon.buf.Write(testZip(t, testZipEntry{name: "Addon/Addon.toc", data: "new"}, tc.input))
+
+			if _, err := addon.extractZip(t.Context()); err == nil {
+				t.Errorf("expected error extracting unsafe zip entry %v", tc.input.name)
+			}
+
+			// nothing should be written, including the safe entries
+			testEq(t, "Addon/Addon.toc", testReadFile(t, addonsDir+"/Addon/Addon.toc"), "old")
+			err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && d.Name() == "evil.lua" {
+					t.Errorf("unsafe zip entry extracted to %v", path)
+				}
+				return err
+			})
+			if err != nil {
+				t.Errorf("error walking test dir: %v", err)
+			}
+		})
+	}
+}
+
+func TestAddon_extractZip_cancelled(t *testing.T) {
+	addonsDir := t.TempDir()
+	testWriteFile(t, addonsDir+"/Addon/Addon.toc", "old")
+
+	addon := &Addon{Name: "proj/addon"}
+	if err := newAddonManager().initializeAddon(addon, &AddonUpdateInfo{ExtractedDirs: []string{"Addon"}}); err != nil {
+		t.Fatalf("error initializing addon: %v", err)
+	}
+	testSharedState(t, addon, t.TempDir(), addonsDir)
+	addon.buf.Write(testZip(t, testZipEntry{name: "Addon/Addon.toc", data: "new"}))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := addon.extractZip(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled extracting zip, got %v", err)
+	}
+
+	testEq(t, "Addon/Addon.toc", testReadFile(t, addonsDir+"/Addon/Addon.toc"), "old")
+	staged, _ := os.ReadDir(addonsDir + "/" + stagingDir)
+	testEq(t, "staged dirs", len(staged), 0)
+}
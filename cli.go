@@ -0,0 +1,731 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+const DefaultConfig = "addons.json"
+
+var (
+	// errUsage is returned when a command is invoked incorrectly. usage has already been printed
+	errUsage = errors.New("invalid usage")
+	// errUpdatesPending is returned by check when updates are available
+	errUpdatesPending = errors.New("updates available")
+)
+
+// cli holds global options and state shared between subcommands
+type cli struct {
+	// cancelled on interrupt, commands should stop starting new work and save what has completed
+	ctx context.Context
+	// path to the addon config, set with --config
+	configFile string
+	// installation to operate on, all installations if empty. set with --install
+	install string
+	// overrides Installation.AddonsDir of the selected installation without saving it to the
+	// config, set with --addons-dir
+	addonsDir string
+	// addon manager loaded from configFile, nil until a command loads it
+	am *AddonManager
+}
+
+type command struct {
+	name string
+	// positional arguments shown in usage
+	args string
+	desc string
+	// setup registers the command's flags on fs and returns the function to run with the
+	// remaining positional args after flags are parsed
+	setup func(c *cli, fs *flag.FlagSet) func(args []string) error
+}
+
+func cliCommands() []*command {
+	return []*command{
+		{
+			name:  "update",
+			args:  "[ADDON...]",
+			desc:  "download and install available updates (default command)",
+			setup: (*cli).updateCmd,
+		}, {
+			name:  "check",
+			args:  "[ADDON...]",
+			desc:  "check for available updates without installing them, exits with status 3 if any are found",
+			setup: (*cli).checkCmd,
+		}, {
+			name:  "list",
+			desc:  "list managed addons",
+			setup: (*cli).listCmd,
+		}, {
+			name:  "info",
+			args:  "ADDON...",
+			desc:  "show details for addons",
+			setup: (*cli).infoCmd,
+		}, {
+			name:  "deps",
+			desc:  "report missing dependencies of installed addons",
+			setup: (*cli).depsCmd,
+		}, {
+			name:  "scan",
+			desc:  "list folders in the AddOns dir not managed by any addon, optionally adopting them",
+			setup: (*cli).scanCmd,
+		}, {
+			name:  "add",
+			args:  "PROJECT/ADDON|URL|ID",
+			desc:  "start managing a new addon",
+			setup: (*cli).addCmd,
+		}, {
+			name:  "remove",
+			args:  "ADDON...",
+			desc:  "uninstall addons and stop managing them",
+			setup: (*cli).removeCmd,
+		}, {
+			name:  "pin",
+			args:  "ADDON...",
+			desc:  "hold addons at their installed version, or pin them to a release with -to",
+			setup: (*cli).pinCmd,
+		}, {
+			name:  "unpin",
+			args:  "ADDON...",
+			desc:  "resume updating held and pinned addons",
+			setup: (*cli).unpinCmd,
+		}, {
+			name:  "rollback",
+			args:  "ADDON...",
+			desc:  "reinstall the previous version of addons, or list the versions kept with -list",
+			setup: (*cli).rollbackCmd,
+		},
+	}
+}
+
+// runCli parses global flags and runs the requested subcommand, defaulting to update. the
+// returned cli is never nil
+func runCli(ctx context.Context, args []string) (*cli, error) {
+	c := &cli{ctx: ctx}
+	commands := cliCommands()
+
+	fs := flag.NewFlagSet("wow-addon-updater", flag.ContinueOnError)
+	fs.StringVar(&c.configFile, "config", DefaultConfig, "path to addon config")
+	fs.StringVar(&c.install, "install", "", "only operate on the named installation")
+	fs.StringVar(&c.addonsDir, "addons-dir", "", "path to the wow AddOns folder, overrides AddonsDir of the selected installation")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: %v [flags] [command] [args]\n\ncommands:\n", fs.Name())
+		for _, cmd := range commands {
+			fmt.Fprintf(out, "  %-8v %v\n", cmd.name, cmd.desc)
+		}
+		fmt.Fprintf(out, "\nflags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, parseErr(err)
+	}
+
+	name, args := "update", fs.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	idx := -1
+	for i, cmd := range commands {
+		if cmd.name == name {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		fmt.Fprintf(fs.Output(), "unknown command %v\n", name)
+		fs.Usage()
+		return c, errUsage
+	}
+	cmd := commands[idx]
+
+	cmdFs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	run := cmd.setup(c, cmdFs)
+	cmdFs.Usage = func() {
+		out := cmdFs.Output()
+		fmt.Fprintf(out, "usage: %v %v\n\n%v\n", cmd.name, cmd.args, cmd.desc)
+		hasFlags := false
+		cmdFs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(out, "\nflags:\n")
+			cmdFs.PrintDefaults()
+		}
+	}
+	if err := cmdFs.Parse(args); err != nil {
+		return c, parseErr(err)
+	}
+
+	return c, run(cmdFs.Args())
+}
+
+// parseErr maps flag parsing errors to errUsage, flag has already reported the error
+func parseErr(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return errUsage
+}
+
+// usageErr prints msg and the usage of fs, returning errUsage
+func usageErr(fs *flag.FlagSet, msg string) error {
+	fmt.Fprintln(fs.Output(), msg)
+	fs.Usage()
+	return errUsage
+}
+
+func (c *cli) load() (*AddonManager, error) {
+	am, err := LoadAddonCfg(c.configFile)
+	c.am = am
+	if err != nil {
+		return nil, fmt.Errorf("error loading addon config from %v: %w", c.configFile, err)
+	}
+
+	installs, err := c.installs()
+	if err != nil {
+		return nil, err
+	}
+	if c.addonsDir != "" {
+		if len(installs) != 1 {
+			return nil, fmt.Errorf("--addons-dir requires --install when using multiple installations")
+		}
+		installs[0].addonsDir = c.addonsDir
+	}
+
+	// addons deleted from the config by hand leave their folders behind, their update info is
+	// dropped on the next save
+	for _, inst := range installs {
+		orphaned, err := inst.orphanedUpdateInfo()
+		if err != nil {
+			continue
+		}
+		for _, name := range slices.Sorted(maps.Keys(orphaned)) {
+			fmt.Printf("%v %v is no longer in the config but its folders are still installed: %v (see scan)\n",
+				tcYellow("warning:"), name, strings.Join(orphaned[name], ", "))
+		}
+	}
+
+	return am, nil
+}
+
+// installs returns the installation selected with --install, or all installations
+func (c *cli) installs() ([]*Installation, error) {
+	if c.install == "" {
+		return c.am.installs(), nil
+	}
+
+	inst, err := c.am.findInstall(c.install)
+	if err != nil {
+		return nil, err
+	}
+	return []*Installation{inst}, nil
+}
+
+func (c *cli) save() error {
+	if err := c.am.SaveAddonCfg(c.configFile); err != nil {
+		return fmt.Errorf("error saving addon config to %v: %w", c.configFile, err)
+	}
+
+	return nil
+}
+
+// loadAddons loads the config and selects the addons matching names, all addons if names is empty
+func (c *cli) loadAddons(names []string) ([]*Addon, error) {
+	am, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	installs, err := c.installs()
+	if err != nil {
+		return nil, err
+	}
+
+	return am.selectAddons(installs, names)
+}
+
+// readMissingTocs reads tocs from disk for addons installed before tocs were tracked. they are saved
+// with the next update, failing to read them only prints a warning
+func (c *cli) readMissingTocs(addons []*Addon) {
+	for _, inst := range c.am.installs() {
+		if err := inst.readMissingTocs(addons); err != nil {
+			fmt.Println(tcYellow("warning:"), "unable to read toc:", err)
+		}
+	}
+}
+
+func (c *cli) updateCmd(fs *flag.FlagSet) func(args []string) error {
+	deps := fs.Bool("deps", false, "add and install missing dependencies found in DependencyRepos")
+
+	return func(args []string) error {
+		addons, err := c.loadAddons(args)
+		if err != nil {
+			return err
+		}
+		if *deps {
+			c.am.installDeps = true
+		}
+
+		updateErr := c.am.UpdateAddons(c.ctx, addons)
+		return errors.Join(updateErr, c.save())
+	}
+}
+
+func (c *cli) checkCmd(fs *flag.FlagSet) func(args []string) error {
+	return func(args []string) error {
+		addons, err := c.loadAddons(args)
+		if err != nil {
+			return err
+		}
+
+		pending, err := c.am.CheckAddons(c.ctx, addons)
+		if err == nil && pending > 0 {
+			return errUpdatesPending
+		}
+		return err
+	}
+}
+
+func (c *cli) listCmd(fs *flag.FlagSet) func(args []string) error {
+	return func(args []string) error {
+		if len(args) != 0 {
+			return usageErr(fs, "list does not take any arguments")
+		}
+		am, err := c.load()
+		if err != nil {
+			return err
+		}
+
+		installs, err := c.installs()
+		if err != nil {
+			return err
+		}
+
+		for i, inst := range installs {
+			if len(am.installs()) > 1 {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Printf("[%v %v]\n", tcDim("Installation"), tcCyan(inst.displayName()))
+			}
+
+			c.readMissingTocs(inst.Addons)
+			inst.resolveInterface()
+			for _, addon := range inst.Addons {
+				held, title := addon.pinInfo(""), ""
+				if addon.Skip {
+					held += tcDim(" (held)")
+				}
+				if dir, toc := addon.mainToc(); toc != nil {
+					title = tcDim(fmt.Sprintf(" - %v %v", toc.plainTitle(dir), toc.Version))
+					if !addon.compatible(toc.Interface) {
+						title += tcYellow(" (out of date)")
+					}
+				}
+				fmt.Printf("%v%v %v on %v%v%v\n", tcDim(addon.projName), tcCyan(addon.shortName), tcGreen(addon.Version),
+					fmtUpdateInfo(addon.RelType, addon.UpdatedOn, addon.RefSha), title, held)
+			}
+		}
+
+		return nil
+	}
+}
+
+func (c *cli) depsCmd(fs *flag.FlagSet) func(args []string) error {
+	return func(args []string) error {
+		if len(args) != 0 {
+			return usageErr(fs, "deps does not take any arguments")
+		}
+		am, err := c.load()
+		if err != nil {
+			return err
+		}
+		installs, err := c.installs()
+		if err != nil {
+			return err
+		}
+
+		errs := []error{}
+		for _, inst := range installs {
+			if len(am.installs()) > 1 {
+				fmt.Printf("[%v %v]\n", tcDim("Installation"), tcCyan(inst.displayName()))
+			}
+			if _, err := am.resolveDependencies(inst, false); err != nil {
+				errs = append(errs, fmt.Errorf("installation %v: %w", inst.displayName(), err))
+			}
+		}
+
+		return errors.Join(errs...)
+	}
+}
+
+func (c *cli) scanCmd(fs *flag.FlagSet) func(args []string) error {
+	adopt := map[string]string{}
+	fs.Func("adopt", "adopt folder `DIR=PROJECT/ADDON`, can be repeated", func(v string) error {
+		dir, repo, ok := strings.Cut(v, "=")
+		if !ok || dir == "" || repo == "" {
+			return fmt.Errorf("expected DIR=PROJECT/ADDON")
+		}
+		adopt[strings.ToLower(dir)] = repo
+		return nil
+	})
+	interactive := fs.Bool("i", false, "prompt for the addon to adopt each folder into")
+
+	return func(args []string) error {
+		if len(args) != 0 {
+			return usageErr(fs, "scan does not take any arguments")
+		}
+		am, err := c.load()
+		if err != nil {
+			return err
+		}
+		installs, err := c.installs()
+		if err != nil {
+			return err
+		}
+		stdin := bufio.NewScanner(os.Stdin)
+
+		adopted, eof := 0, false
+	scan:
+		for _, inst := range installs {
+			if len(am.installs()) > 1 {
+				fmt.Printf("[%v %v]\n", tcDim("Installation"), tcCyan(inst.displayName()))
+			}
+			orphans, err := inst.orphanDirs()
+			if err != nil {
+				return fmt.Errorf("error scanning installation %v: %w", inst.displayName(), err)
+			}
+
+			for _, orphan := range orphans {
+				details := []string{}
+				if v := orphan.tag("X-Website"); v != "" {
+					details = append(details, v)
+				}
+				if v := orphan.tag("X-Curse-Project-ID"); v != "" {
+					details = append(details, "curse "+v)
+				}
+				fmt.Printf("%v %v %v\n", tcCyan(orphan.dir), orphan.toc.plainTitle(orphan.dir), tcDim(strings.Join(details, " ")))
+
+				repo := adopt[strings.ToLower(orphan.dir)]
+				if repo == "" && *interactive {
+					suggested := orphan.suggestedRepo()
+					fmt.Printf("  adopt into PROJECT/ADDON, - to skip [%v]: ", suggested)
+					if !stdin.Scan() {
+						// keep folders adopted so far, the remaining folders stay unmanaged
+						fmt.Println()
+						eof = true
+						break scan
+					}
+					repo = cmp.Or(strings.TrimSpace(stdin.Text()), suggested)
+				}
+				delete(adopt, strings.ToLower(orphan.dir))
+				if repo == "" || repo == "-" {
+					continue
+				}
+
+				addon, err := inst.adoptDir(orphan, repo)
+				if err != nil {
+					return fmt.Errorf("error adopting %v: %w", orphan.dir, err)
+				}
+				adopted++
+				fmt.Printf("  adopted by %v%v\n", tcDim(addon.projName), tcCyan(addon.shortName))
+			}
+		}
+
+		errs := []error{stdin.Err()}
+		for dir := range adopt {
+			// folders after eof were never scanned
+			if !eof {
+				errs = append(errs, fmt.Errorf("%v is not an unmanaged folder", dir))
+			}
+		}
+		if adopted != 0 {
+			errs = append(errs, c.save())
+		}
+		return errors.Join(errs...)
+	}
+}
+
+func (c *cli) infoCmd(fs *flag.FlagSet) func(args []string) error {
+	return func(args []string) error {
+		if len(args) == 0 {
+			return usageErr(fs, "info expects at least one addon")
+		}
+		addons, err := c.loadAddons(args)
+		if err != nil {
+			return err
+		}
+
+		c.readMissingTocs(addons)
+		for _, addon := range addons {
+			fmt.Println(addon)
+		}
+
+		return nil
+	}
+}
+
+func (c *cli) addCmd(fs *flag.FlagSet) func(args []string) error {
+	tag := fs.Bool("tag", false, "track tagged commits instead of releases")
+	gitlab := fs.Bool("gitlab", false, "track gitlab releases, the addon can also be a gitlab project url")
+	gitea := fs.Bool("gitea", false, "track gitea or forgejo releases (codeberg by default), the addon can also be a repository url")
+	curseforge := fs.Bool("curseforge", false, "track curseforge files, the addon is the curseforge project id")
+	wowinterface := fs.Bool("wowinterface", false, "track wowinterface files, the addon is the wowinterface file id or url")
+	wago := fs.Bool("wago", false, "track wago releases, the addon is the wago project slug, id or url")
+	channel := fs.String("channel", "", "least stable release channel to install for curseforge and wago: release (default), beta or alpha")
+	apiUrl := fs.String("api-url", "", "api base url of a self-hosted instance, eg https://gitlab.example.com/api/v4")
+	skip := fs.Bool("skip", false, "add the addon without updating it")
+	dirs := fs.String("dirs", "", "comma separated top-level dirs to extract, prefix a dir with '-' to exclude it")
+	interactive := fs.Bool("i", false, "prompt for the dirs to extract")
+	noProbe := fs.Bool("no-probe", false, "add the addon without looking up its releases")
+
+	return func(args []string) error {
+		// tagged commits are supported by github and gitea
+		sources := 0
+		for _, set := range []bool{*gitlab, *gitea, *curseforge, *wowinterface, *wago} {
+			if set {
+				sources++
+			}
+		}
+		if len(args) != 1 {
+			return usageErr(fs, "add expects a single addon")
+		} else if sources > 1 {
+			return usageErr(fs, "only one of -gitlab, -gitea, -curseforge, -wowinterface and -wago can be used")
+		} else if *tag && (*gitlab || *curseforge || *wowinterface || *wago) {
+			return usageErr(fs, "-tag can only be used with github or gitea addons")
+		}
+		var name, hostApiUrl string
+		var err error
+		switch {
+		case *gitlab:
+			name, hostApiUrl, err = parseGitlabName(args[0])
+		case *gitea:
+			name, hostApiUrl, err = parseGiteaName(args[0])
+		case *curseforge:
+			// curseforge/ID, the id is the addon's short name
+			name = "curseforge/" + args[0]
+		case *wowinterface:
+			var fileId string
+			fileId, err = parseWowinterfaceId(args[0])
+			name = "wowinterface/" + fileId
+		case *wago:
+			var slug string
+			slug, err = parseWagoSlug(args[0])
+			name = "wago/" + slug
+		default:
+			name, err = parseAddonName(args[0])
+		}
+		if err != nil {
+			return err
+		}
+		am, err := c.load()
+		if err != nil {
+			return err
+		}
+		installs, err := c.installs()
+		if err != nil {
+			return err
+		} else if len(installs) != 1 {
+			return usageErr(fs, "add requires --install when using multiple installations")
+		}
+		inst := installs[0]
+		if _, ok := inst.UpdateInfo[name]; ok {
+			return fmt.Errorf("addon %v is already managed", name)
+		}
+
+		addon := &Addon{Name: name, Skip: *skip, ApiUrl: cmp.Or(*apiUrl, hostApiUrl), Channel: *channel}
+		switch {
+		case *gitea && *tag:
+			addon.RelType = GtTag
+		case *gitea:
+			addon.RelType = GtRel
+		case *tag:
+			addon.RelType = GhTag
+		case *gitlab:
+			addon.RelType = GlRel
+		case *curseforge:
+			addon.RelType = CfRel
+		case *wowinterface:
+			addon.RelType = WiRel
+		case *wago:
+			addon.RelType = WgRel
+		}
+		if *dirs != "" {
+			addon.Dirs = strings.Split(*dirs, ",")
+		}
+
+		if !*noProbe {
+			// probe a copy, initializing an addon twice duplicates its dirs
+			probe := &Addon{Name: addon.Name, RelType: addon.RelType, ApiUrl: addon.ApiUrl, Channel: addon.Channel}
+			zipDirs, err := am.ProbeAddon(c.ctx, inst, probe)
+			if err != nil {
+				return err
+			}
+			addon.RelType = probe.RelType
+
+			if *interactive && *dirs == "" {
+				fmt.Printf("dirs to extract, prefix a dir with '-' to exclude it [%v]: ", strings.Join(zipDirs, ","))
+				stdin := bufio.NewScanner(os.Stdin)
+				if !stdin.Scan() {
+					return cmp.Or(stdin.Err(), fmt.Errorf("no dirs entered, %v was not added", addon.Name))
+				}
+				if input := strings.TrimSpace(stdin.Text()); input != "" {
+					addon.Dirs = strings.Split(input, ",")
+				}
+			}
+
+			// catch typos in Dirs, they would silently extract nothing
+			for _, dir := range addon.Dirs {
+				dir = strings.TrimSuffix(strings.TrimPrefix(dir, "-"), "/")
+				if !slices.Contains(zipDirs, dir) {
+					return fmt.Errorf("dir %v not found in release, expected one of %v", dir, strings.Join(zipDirs, ", "))
+				}
+			}
+		}
+
+		if err := inst.addAddon(addon); err != nil {
+			return err
+		}
+		fmt.Printf("added %v%v\n", tcDim(addon.projName), tcCyan(addon.shortName))
+
+		return c.save()
+	}
+}
+
+func (c *cli) removeCmd(fs *flag.FlagSet) func(args []string) error {
+	keepFiles := fs.Bool("keep-files", false, "stop managing addons without deleting their folders")
+
+	return func(args []string) error {
+		if len(args) == 0 {
+			return usageErr(fs, "remove expects at least one addon")
+		}
+		addons, err := c.loadAddons(args)
+		if err != nil {
+			return err
+		}
+
+		errs := []error{}
+		for _, addon := range addons {
+			if err := c.am.RemoveAddon(addon, *keepFiles); err != nil {
+				errs = append(errs, fmt.Errorf("error removing %v: %w", addon.Name, err))
+				continue
+			}
+			fmt.Printf("removed %v%v\n", tcDim(addon.projName), tcCyan(addon.shortName))
+		}
+
+		return errors.Join(append(errs, c.save())...)
+	}
+}
+
+func (c *cli) pinCmd(fs *flag.FlagSet) func(args []string) error {
+	to := fs.String("to", "", "install this release tag, or tag or ref sha for tagged commits, instead of holding the installed version")
+
+	return func(args []string) error {
+		if len(args) == 0 {
+			return usageErr(fs, "pin expects at least one addon")
+		}
+		addons, err := c.loadAddons(args)
+		if err != nil {
+			return err
+		}
+
+		for _, addon := range addons {
+			if *to == "" {
+				addon.Skip = true
+			} else if !addon.RelType.pinnable() {
+				return fmt.Errorf("%v cannot be pinned, only the latest release can be downloaded", addon.Name)
+			} else {
+				addon.Pin = *to
+			}
+		}
+
+		return c.save()
+	}
+}
+
+func (c *cli) unpinCmd(fs *flag.FlagSet) func(args []string) error {
+	return func(args []string) error {
+		if len(args) == 0 {
+			return usageErr(fs, "unpin expects at least one addon")
+		}
+		addons, err := c.loadAddons(args)
+		if err != nil {
+			return err
+		}
+
+		for _, addon := range addons {
+			addon.Skip, addon.Pin = false, ""
+		}
+
+		return c.save()
+	}
+}
+
+func (c *cli) rollbackCmd(fs *flag.FlagSet) func(args []string) error {
+	to := fs.Int("to", 0, "generation to reinstall, as shown by -list (default: the previous version)")
+	list := fs.Bool("list", false, "list the previous versions kept instead of rolling back")
+
+	return func(args []string) error {
+		if len(args) == 0 {
+			return usageErr(fs, "rollback expects at least one addon")
+		}
+		addons, err := c.loadAddons(args)
+		if err != nil {
+			return err
+		}
+
+		if *list {
+			errs := []error{}
+			for _, addon := range addons {
+				gens, err := addon.install.generations(addon)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("error reading previous versions of %v: %w", addon.Name, err))
+					continue
+				}
+
+				fmt.Printf("%v%v\n", tcDim(addon.projName), tcCyan(addon.shortName))
+				if len(gens) == 0 {
+					fmt.Println(tcDim("  no previous versions kept"))
+				}
+				for _, gen := range gens {
+					fmt.Printf("  %3d %v on %v %v\n", gen.Id, tcGreen(gen.Version), fmtUpdateInfo(addon.RelType, gen.UpdatedOn, gen.RefSha),
+						tcDim("replaced "+gen.ReplacedOn.Local().Format("Jan 2, 2006 15:04")))
+				}
+			}
+			return errors.Join(errs...)
+		}
+
+		errs := []error{}
+		for _, addon := range addons {
+			if err := c.am.RollbackAddon(c.ctx, addon, *to); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !addon.Skip && addon.Pin == "" {
+				fmt.Printf("%v will be updated again on the next update, pin it to keep this version\n", addon.Name)
+			}
+		}
+
+		return errors.Join(append(errs, c.save())...)
+	}
+}
+
+// exitCode maps the result of runCli to a process exit code
+func exitCode(err error) int {
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	case errors.Is(err, errUpdatesPending):
+		return 3
+	default:
+		return 1
+	}
+}
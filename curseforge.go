@@ -0,0 +1,162 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const curseforgeApiUrl = "https://api.curseforge.com"
+
+// release channels, each channel also installs releases from more stable channels
+const (
+	ChannelRelease = "release" // default
+	ChannelStable  = "stable"  // wago's name for release
+	ChannelBeta    = "beta"
+	ChannelAlpha   = "alpha"
+)
+
+// channelStability orders channels from most to least stable, matching curseforge release types
+var channelStability = map[string]int{"": 1, ChannelRelease: 1, ChannelStable: 1, ChannelBeta: 2, ChannelAlpha: 3}
+
+// validChannel checks channel is a known release channel, empty defaults to release
+func validChannel(channel string) error {
+	if _, ok := channelStability[channel]; !ok {
+		return fmt.Errorf("unknown channel %v, expected one of %v (or %v), %v, %v", channel, ChannelRelease, ChannelStable, ChannelBeta, ChannelAlpha)
+	}
+	return nil
+}
+
+type cfFile struct {
+	Id          int
+	DisplayName string
+	FileName    string
+	// 1 = release, 2 = beta, 3 = alpha
+	ReleaseType int
+	FileDate    time.Time
+	FileLength  int64
+	// null if the author does not allow third party downloads
+	DownloadUrl  string
+	GameVersions []string
+	IsAvailable  bool
+}
+
+// cfResponse wraps every curseforge api response
+type cfResponse[T any] struct {
+	Data T
+}
+
+// curseforgeApi returns the api base url for curseforge, ApiUrl or api.curseforge.com
+func (a *Addon) curseforgeApi() string {
+	if a.ApiUrl == "" {
+		return curseforgeApiUrl
+	}
+	return strings.TrimSuffix(a.ApiUrl, "/")
+}
+
+// projectId is ProjectId or the short name of the addon, ie PROJECT/ID
+func (a *Addon) projectId() string {
+	return cmp.Or(a.ProjectId, a.shortName)
+}
+
+// curseforgeFiles returns the endpoint and cache file of the latest files of the project for the
+// addon's flavor, or of file fileId if set
+func (a *Addon) curseforgeFiles(fileId string) (endpoint, cacheFilename string) {
+	const FilesEndpoint = "%v/v1/mods/%v/files?gameVersionTypeId=%v&pageSize=50"
+	const FileEndpoint = "%v/v1/mods/%v/files/%v"
+
+	projectId := url.PathEscape(a.projectId())
+	if fileId == "" {
+		versionType := gameFlavors[cmp.Or(a.flavor, FlavorMainline)].curseforgeVersionType
+		return fmt.Sprintf(FilesEndpoint, a.curseforgeApi(), projectId, versionType),
+			fmt.Sprintf("%v-cf.json", a.shortName)
+	}
+	return fmt.Sprintf(FileEndpoint, a.curseforgeApi(), projectId, url.PathEscape(fileId)),
+		fmt.Sprintf("%v-cf-%v.json", a.shortName, url.PathEscape(fileId))
+}
+
+func (a *Addon) getCurseforgeFile(ctx context.Context) (*downloadAsset, error) {
+	if a.curseforgeApiKey == "" {
+		return nil, fmt.Errorf("curseforge api key required, set CurseForgeApiKey or $CURSEFORGE_API_KEY")
+	}
+
+	var file *cfFile
+	if a.Pin != "" {
+		endpoint, cacheFilename := a.curseforgeFiles(a.Pin)
+		res, err := fetchJson[cfResponse[*cfFile]](ctx, a, endpoint, cacheFilename)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching pinned file %v: %w", a.Pin, err)
+		}
+		file = res.Data
+	} else {
+		endpoint, cacheFilename := a.curseforgeFiles("")
+		res, err := fetchJson[cfResponse[[]*cfFile]](ctx, a, endpoint, cacheFilename)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching update info: %w", err)
+		}
+		file = a.latestCurseforgeFile(res.Data)
+	}
+
+	if file == nil {
+		return nil, fmt.Errorf("no %v files found for project %v", cmp.Or(a.Channel, ChannelRelease), a.projectId())
+	} else if file.DownloadUrl == "" {
+		return nil, fmt.Errorf("%v can only be downloaded from curseforge, the author disabled third party downloads", file.FileName)
+	}
+
+	ifaces := []int{}
+	for _, version := range file.GameVersions {
+		if iface, err := interfaceVersion(version); err == nil {
+			ifaces = append(ifaces, iface)
+		}
+	}
+
+	asset := &downloadAsset{
+		Name:        file.FileName,
+		Size:        file.FileLength,
+		DownloadUrl: file.DownloadUrl,
+		ContentType: "application/zip",
+		UpdatedAt:   file.FileDate,
+		RefSha:      strconv.Itoa(file.Id),
+		Version:     file.DisplayName,
+		RelType:     CfRel,
+		Interface:   ifaces,
+	}
+
+	return asset, nil
+}
+
+// latestCurseforgeFile returns the newest available file in the addon's channel, nil if none
+func (a *Addon) latestCurseforgeFile(files []*cfFile) *cfFile {
+	stability := channelStability[a.Channel]
+
+	var latest *cfFile
+	for _, file := range files {
+		if !file.IsAvailable || file.ReleaseType < 1 || file.ReleaseType > stability {
+			continue
+		}
+		if latest == nil || file.FileDate.After(latest.FileDate) {
+			latest = file
+		}
+	}
+
+	return latest
+}
+
+// newerCurseforgeFile returns the name of the latest file if it is not the pinned file
+func (a *Addon) newerCurseforgeFile(ctx context.Context) (string, error) {
+	endpoint, cacheFilename := a.curseforgeFiles("")
+	res, err := decodeJson[cfResponse[[]*cfFile]](ctx, a, endpoint, cacheFilename, false)
+	if err != nil {
+		return "", err
+	}
+
+	latest := a.latestCurseforgeFile(res.Data)
+	if latest == nil || strconv.Itoa(latest.Id) == a.Pin {
+		return "", nil
+	}
+	return latest.DisplayName, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testCurseforgeApi stands in for the curseforge api under /api, serving the files of project 1234
+// and their archives under /cdn. requests to the api without the api key are rejected
+func testCurseforgeApi(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	const fileJson = `{"id": %v, "displayName": "%v", "fileName": "addon-%v.zip", "releaseType": %v,
+		"fileDate": "%v", "downloadUrl": %v, "gameVersions": ["%v"], "isAvailable": %v}`
+	file := func(host string, id, releaseType int, date, version string, available bool) string {
+		downloadUrl := fmt.Sprintf(`"http://%v/cdn/addon-%v.zip"`, host, id)
+		if id == 9 {
+			downloadUrl = "null"
+		}
+		return fmt.Sprintf(fileJson, id, "Addon "+fmt.Sprint(id), id, releaseType, date, downloadUrl, version, available)
+	}
+	addonZip := testZip(t, testZipEntry{name: "Addon/Addon.toc", data: "## Interface: 110105"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/mods/1234/files", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		files := []string{}
+		switch r.URL.Query().Get("gameVersionTypeId") {
+		case "517":
+			files = append(files,
+				file(r.Host, 1, 1, "2024-05-01T00:00:00Z", "11.1.5", true),
+				file(r.Host, 3, 3, "2024-07-01T00:00:00Z", "11.1.7", true),
+				file(r.Host, 2, 2, "2024-06-01T00:00:00Z", "11.1.5", true),
+				file(r.Host, 4, 1, "2024-08-01T00:00:00Z", "11.1.7", false),
+			)
+		case "67408":
+			files = append(files, file(r.Host, 10, 1, "2024-05-01T00:00:00Z", "1.15.7", true))
+		case "73713":
+			files = append(files, file(r.Host, 9, 1, "2024-05-01T00:00:00Z", "3.4.4", true))
+		}
+		fmt.Fprintf(w, `{"data": [%v]}`, strings.Join(files, ","))
+	})
+	mux.HandleFunc("/api/v1/mods/1234/files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"data": %v}`, file(r.Host, 1, 1, "2024-05-01T00:00:00Z", "11.1.5", true))
+	})
+	mux.HandleFunc("/cdn/", func(w http.ResponseWriter, r *http.Request) {
+		// the api key is only sent to the api
+		if r.Header.Get("x-api-key") != "" {
+			t.Errorf("api key sent to %v", r.URL)
+		}
+		w.Write(addonZip)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAddon_getCurseforgeFile(t *testing.T) {
+	srv := testCurseforgeApi(t)
+
+	tests := []struct {
+		name    string
+		flavor  string
+		channel string
+		pin     string
+		fileId  string
+		ifaces  []int
+	}{
+		{"release", "", "", "", "1", []int{110105}},
+		{"beta", "", ChannelBeta, "", "2", []int{110105}},
+		{"alpha", "", ChannelAlpha, "", "3", []int{110107}},
+		{"classic", FlavorClassic, "", "", "10", []int{11507}},
+		{"pinned", "", ChannelAlpha, "1", "1", []int{110105}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := &Installation{Flavor: tc.flavor}
+			addon := &Addon{Name: "curseforge/1234", RelType: CfRel, Channel: tc.channel, Pin: tc.pin, ApiUrl: srv.URL + "/api"}
+			if err := inst.initializeAddon(addon, nil); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			testSharedState(t, addon, "", t.TempDir())
+			addon.curseforgeApiKey = "key"
+
+			asset, err := addon.checkUpdate(t.Context())
+			if err != nil {
+				t.Fatalf("error finding curseforge file: %v", err)
+			}
+			testEq(t, "RefSha", asset.RefSha, tc.fileId)
+			testEq(t, "Version", asset.Version, "Addon "+tc.fileId)
+			testEq(t, "DownloadUrl", asset.DownloadUrl, srv.URL+"/cdn/addon-"+tc.fileId+".zip")
+			testEqFunc(t, "Interface", asset.Interface, tc.ifaces, slices.Equal)
+		})
+	}
+}
+
+func TestAddon_getCurseforgeFile_fail(t *testing.T) {
+	srv := testCurseforgeApi(t)
+
+	tests := []struct {
+		name   string
+		flavor string
+		apiKey string
+	}{
+		{"no api key", "", ""},
+		{"wrong api key", "", "wrong"},
+		{"third party downloads disabled", FlavorWrath, "key"},
+		{"no files", FlavorCata, "key"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := &Installation{Flavor: tc.flavor}
+			addon := &Addon{Name: "curseforge/1234", RelType: CfRel, ApiUrl: srv.URL + "/api"}
+			if err := inst.initializeAddon(addon, nil); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			testSharedState(t, addon, "", t.TempDir())
+			addon.curseforgeApiKey = tc.apiKey
+
+			if asset, err := addon.checkUpdate(t.Context()); err == nil {
+				t.Errorf("expected error finding curseforge file, got %v", asset.Name)
+			}
+		})
+	}
+}
+
+func TestAddon_update_curseforge(t *testing.T) {
+	srv := testCurseforgeApi(t)
+	addonsDir := t.TempDir()
+
+	addon := &Addon{Name: "curseforge/1234", RelType: CfRel, ApiUrl: srv.URL + "/api"}
+	if err := newAddonManager().initializeAddon(addon, &AddonUpdateInfo{RefSha: "0"}); err != nil {
+		t.Fatalf("error initializing addon: %v", err)
+	}
+	testSharedState(t, addon, "", addonsDir)
+	addon.curseforgeApiKey = "key"
+
+	if status := addon.update(t.Context()); status.err != nil {
+		t.Fatalf("error updating addon: %v", status.err)
+	}
+	// the file id is the version marker
+	testEq(t, "RefSha", addon.RefSha, "1")
+	testEq(t, "Version", addon.Version, "Addon 1")
+	testEqFunc(t, "ExtractedDirs", addon.ExtractedDirs, []string{"Addon"}, slices.Equal)
+	testEq(t, "Addon/Addon.toc", testReadFile(t, addonsDir+"/Addon/Addon.toc"), "## Interface: 110105")
+
+	if status := addon.update(t.Context()); status.err != nil || status.hasUpdate {
+		t.Errorf("expected no update for installed file, got %v (err %v)", status.hasUpdate, status.err)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// missingDependency is an addon folder required by installed addons that is not installed
+type missingDependency struct {
+	dir string
+	// installed folders that require dir
+	requiredBy []string
+	// addon providing dir from AddonManager.DependencyRepos, empty if unknown
+	repo string
+}
+
+// installedDirs returns the lowercased names of every top-level folder in the AddOns dir
+func (inst *Installation) installedDirs() (map[string]bool, error) {
+	dirs, err := inst.addonDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	installed := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		installed[strings.ToLower(dir)] = true
+	}
+
+	return installed, nil
+}
+
+// installedTocs returns the tocs of every folder extracted by inst's addons, keyed by folder
+func (inst *Installation) installedTocs() map[string]*tocInfo {
+	tocs := map[string]*tocInfo{}
+	for _, addon := range inst.Addons {
+		for _, dir := range addon.ExtractedDirs {
+			if toc := addon.Toc[dir]; toc != nil {
+				tocs[dir] = toc
+			}
+		}
+	}
+
+	return tocs
+}
+
+// missingDependencies finds the required dependencies of inst's addons that are not in the AddOns
+// dir, sorted by folder. repos maps dependency folders to the addon providing them
+func (inst *Installation) missingDependencies(repos map[string]string) ([]*missingDependency, error) {
+	installed, err := inst.installedDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	tocs := inst.installedTocs()
+	missing := map[string]*missingDependency{}
+	for _, dir := range slices.Sorted(maps.Keys(tocs)) {
+		for _, dep := range tocs[dir].Dependencies {
+			// blizzard addons ship with the client
+			if installed[strings.ToLower(dep)] || strings.HasPrefix(strings.ToLower(dep), "blizzard_") {
+				continue
+			}
+
+			key := strings.ToLower(dep)
+			if missing[key] == nil {
+				missing[key] = &missingDependency{dir: dep, repo: dependencyRepo(repos, dep)}
+			}
+			missing[key].requiredBy = append(missing[key].requiredBy, dir)
+		}
+	}
+
+	deps := slices.Collect(maps.Values(missing))
+	slices.SortFunc(deps, func(a, b *missingDependency) int { return strings.Compare(a.dir, b.dir) })
+
+	return deps, nil
+}
+
+// dependencyRepo looks up the addon providing dir, dir is matched case-insensitively
+func dependencyRepo(repos map[string]string, dir string) string {
+	if repo, ok := repos[dir]; ok {
+		return repo
+	}
+	for name, repo := range repos {
+		if strings.EqualFold(name, dir) {
+			return repo
+		}
+	}
+
+	return ""
+}
+
+// dependencyCycles finds folders that (indirectly) require themselves. each cycle is listed once,
+// starting from its first folder in sorted order, eg [A B A]
+func dependencyCycles(tocs map[string]*tocInfo) [][]string {
+	// lowercased folder => canonical folder name
+	names := make(map[string]string, len(tocs))
+	for dir := range tocs {
+		names[strings.ToLower(dir)] = dir
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	cycles := [][]string{}
+	path := []string{}
+
+	var visit func(dir string)
+	visit = func(dir string) {
+		state[dir] = visiting
+		path = append(path, dir)
+
+		for _, dep := range tocs[dir].Dependencies {
+			dep, ok := names[strings.ToLower(dep)]
+			if !ok {
+				continue
+			}
+
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				idx := slices.Index(path, dep)
+				cycles = append(cycles, append(slices.Clone(path[idx:]), dep))
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[dir] = visited
+	}
+
+	for _, dir := range slices.Sorted(maps.Keys(tocs)) {
+		if state[dir] == unvisited {
+			visit(dir)
+		}
+	}
+
+	return cycles
+}
+
+// resolveDependencies reports the missing dependencies and dependency cycles of inst's addons. if
+// install is set, missing dependencies with a known repo are added to inst and returned so they can
+// be installed
+func (am *AddonManager) resolveDependencies(inst *Installation, install bool) ([]*Addon, error) {
+	if err := inst.readMissingTocs(inst.Addons); err != nil {
+		fmt.Println(tcYellow("warning:"), "unable to read toc:", err)
+	}
+
+	deps, err := inst.missingDependencies(am.DependencyRepos)
+	if err != nil {
+		return nil, fmt.Errorf("error checking dependencies: %w", err)
+	}
+	cycles := dependencyCycles(inst.installedTocs())
+	if len(deps) == 0 && len(cycles) == 0 {
+		return nil, nil
+	}
+
+	added := []*Addon{}
+	fmt.Printf("[%v]\n", tcDim("Missing Dependencies"))
+	for _, dep := range deps {
+		requiredBy := tcDim("required by " + strings.Join(dep.requiredBy, ", "))
+
+		switch {
+		case dep.repo == "":
+			fmt.Printf("%v %v, %v\n", tcCyan(dep.dir), requiredBy, tcYellow("no repo configured in DependencyRepos"))
+		case !install:
+			fmt.Printf("%v %v, provided by %v\n", tcCyan(dep.dir), requiredBy, dep.repo)
+		default:
+			if addon, err := inst.findAddon(dep.repo); err == nil {
+				// already tracked, but the update failed or the addon is held
+				fmt.Printf("%v %v, %v is not installed\n", tcCyan(dep.dir), requiredBy, addon.Name)
+				continue
+			}
+
+			addon := &Addon{Name: dep.repo}
+			if err := inst.addAddon(addon); err != nil {
+				fmt.Printf("%v %v, %v %v\n", tcCyan(dep.dir), requiredBy, tcRed("error adding"), err)
+				continue
+			}
+			added = append(added, addon)
+			fmt.Printf("%v %v, added %v\n", tcCyan(dep.dir), requiredBy, dep.repo)
+		}
+	}
+	for _, cycle := range cycles {
+		fmt.Printf("%v %v\n", tcYellow("dependency cycle:"), strings.Join(cycle, " -> "))
+	}
+	fmt.Println()
+
+	return added, nil
+}
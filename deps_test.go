@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInstallation_missingDependencies(t *testing.T) {
+	addonsDir := t.TempDir()
+	testWriteFile(t, addonsDir+"/Plugin/Plugin.toc", "")
+	testWriteFile(t, addonsDir+"/Plugin_Extra/Plugin_Extra.toc", "")
+	testWriteFile(t, addonsDir+"/LibStub/LibStub.toc", "")
+
+	inst := &Installation{AddonsDir: addonsDir}
+	inst.Addons = []*Addon{{Name: "proj/plugin"}}
+	if err := inst.initialize("", true); err != nil {
+		t.Fatalf("error initializing installation: %v", err)
+	}
+	inst.Addons[0].ExtractedDirs = []string{"Plugin", "Plugin_Extra"}
+	inst.Addons[0].Toc = map[string]*tocInfo{
+		"Plugin":       {Dependencies: []string{"Core", "libstub", "Blizzard_NamePlates"}, OptionalDeps: []string{"Ace3"}},
+		"Plugin_Extra": {Dependencies: []string{"Plugin", "Core", "Other"}},
+	}
+
+	deps, err := inst.missingDependencies(map[string]string{"core": "proj/core"})
+	if err != nil {
+		t.Fatalf("error finding missing dependencies: %v", err)
+	}
+
+	if testEq(t, "missing", len(deps), 2) {
+		testEq(t, "Core dir", deps[0].dir, "Core")
+		testEq(t, "Core repo", deps[0].repo, "proj/core")
+		testEqFunc(t, "Core requiredBy", deps[0].requiredBy, []string{"Plugin", "Plugin_Extra"}, slices.Equal)
+		testEq(t, "Other dir", deps[1].dir, "Other")
+		testEq(t, "Other repo", deps[1].repo, "")
+	}
+
+	// missing dependencies with a repo are added to the installation
+	am := newAddonManager()
+	am.DependencyRepos = map[string]string{"Core": "proj/core"}
+	added, err := am.resolveDependencies(inst, true)
+	if err != nil {
+		t.Fatalf("error resolving dependencies: %v", err)
+	}
+	if testEq(t, "added", len(added), 1) {
+		testEq(t, "added name", added[0].Name, "proj/core")
+		testEqPtr(t, "added install", added[0].install, inst)
+		testEqPtr(t, "added updateInfo", added[0].AddonUpdateInfo, inst.UpdateInfo["proj/core"])
+	}
+
+	// tracked dependencies are not added again
+	added, err = am.resolveDependencies(inst, true)
+	if err != nil {
+		t.Fatalf("error resolving dependencies: %v", err)
+	}
+	testEq(t, "added again", len(added), 0)
+	testEq(t, "addons", len(inst.Addons), 2)
+}
+
+func TestDependencyCycles(t *testing.T) {
+	tocs := map[string]*tocInfo{
+		"A":    {Dependencies: []string{"b"}},
+		"B":    {Dependencies: []string{"C", "Missing"}},
+		"C":    {Dependencies: []string{"A"}},
+		"D":    {Dependencies: []string{"D"}},
+		"E":    {Dependencies: []string{"A"}},
+		"Leaf": {},
+	}
+
+	cycles := dependencyCycles(tocs)
+	expected := [][]string{{"A", "B", "C", "A"}, {"D", "D"}}
+	if testEq(t, "cycles", len(cycles), len(expected)) {
+		for i := range cycles {
+			testEqFunc(t, "cycle", cycles[i], expected[i], slices.Equal)
+		}
+	}
+}
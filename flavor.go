@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// game flavors, named after the flavors used in BigWigs packager release.json manifests
+const (
+	FlavorMainline = "mainline"
+	FlavorClassic  = "classic" // classic era
+	FlavorBcc      = "bcc"
+	FlavorWrath    = "wrath"
+	FlavorCata     = "cata"
+	FlavorMists    = "mists"
+)
+
+type gameFlavor struct {
+	// matches release asset names built for this flavor, used when a release has no release.json
+	assetPattern *regexp.Regexp
+	// suffixes of flavor specific toc files (ADDON_SUFFIX.toc) the client loads, in order of
+	// preference over ADDON.toc
+	tocSuffixes []string
+	// curseforge gameVersionTypeId of the flavor
+	curseforgeVersionType int
+	// wago game_version of the flavor
+	wagoGameVersion string
+}
+
+var gameFlavors = map[string]*gameFlavor{
+	// mainline assets are matched by excluding every classic pattern
+	FlavorMainline: {tocSuffixes: []string{"Mainline"}, curseforgeVersionType: 517, wagoGameVersion: "retail"},
+	FlavorClassic: {
+		assetPattern:          regexp.MustCompile(`classic|vanilla`),
+		tocSuffixes:           []string{"Vanilla", "Classic"},
+		curseforgeVersionType: 67408,
+		wagoGameVersion:       "classic",
+	},
+	FlavorBcc: {
+		assetPattern:          regexp.MustCompile(`bcc|tbc`),
+		tocSuffixes:           []string{"TBC", "BCC", "Classic"},
+		curseforgeVersionType: 73246,
+		wagoGameVersion:       "bc",
+	},
+	FlavorWrath: {
+		assetPattern:          regexp.MustCompile(`wrath|wotlk`),
+		tocSuffixes:           []string{"Wrath", "WOTLKC", "Classic"},
+		curseforgeVersionType: 73713,
+		wagoGameVersion:       "wotlk",
+	},
+	FlavorCata: {
+		assetPattern:          regexp.MustCompile(`cata`),
+		tocSuffixes:           []string{"Cata", "Classic"},
+		curseforgeVersionType: 77522,
+		wagoGameVersion:       "cata",
+	},
+	FlavorMists: {
+		assetPattern:          regexp.MustCompile(`mists|mop`),
+		tocSuffixes:           []string{"Mists", "Classic"},
+		curseforgeVersionType: 79434,
+		wagoGameVersion:       "mop",
+	},
+}
+
+// any classic asset, `bc` is kept from before flavors were configurable to match `-bc` builds
+var classicAssetPattern = regexp.MustCompile(`classic|vanilla|bc|wrath|wotlk|cata|mists|mop`)
+
+// validFlavor checks flavor is a known game flavor, an empty flavor defaults to mainline
+func validFlavor(flavor string) error {
+	if _, ok := gameFlavors[flavor]; flavor != "" && !ok {
+		flavors := slices.Sorted(maps.Keys(gameFlavors))
+		return fmt.Errorf("unknown flavor %v, expected one of %v", flavor, strings.Join(flavors, ", "))
+	}
+
+	return nil
+}
+
+// isFlavorAsset reports if a release asset named name was built for flavor
+func isFlavorAsset(name, flavor string) bool {
+	name = strings.ToLower(name)
+	if flavor == "" || flavor == FlavorMainline {
+		return !classicAssetPattern.MatchString(name)
+	}
+
+	return gameFlavors[flavor].assetPattern.MatchString(name)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// codeberg is the largest public forgejo instance, self-hosted gitea and forgejo instances share
+// the same api
+const giteaApiUrl = "https://codeberg.org/api/v1"
+
+type giteaRelease struct {
+	TagName     string    `json:"tag_name"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []struct {
+		Name        string
+		Size        int64
+		DownloadUrl string `json:"browser_download_url"`
+	}
+	// archive of the repository at the tag
+	ZipballUrl string `json:"zipball_url"`
+}
+
+type giteaTag struct {
+	Name   string
+	Commit struct {
+		Sha string
+	}
+	ZipballUrl string `json:"zipball_url"`
+}
+
+// giteaApi returns the api base url for gitea releases and tags, ApiUrl or codeberg.org
+func (a *Addon) giteaApi() string {
+	if a.ApiUrl == "" {
+		return giteaApiUrl
+	}
+	return strings.TrimSuffix(a.ApiUrl, "/")
+}
+
+// giteaRelease returns the endpoint and cache file of the latest release, or of the release tagged
+// tag if set
+func (a *Addon) giteaRelease(tag string) (endpoint, cacheFilename string) {
+	const RelEndpoint = "%v/repos/%v/releases/latest"
+	const TaggedRelEndpoint = "%v/repos/%v/releases/tags/%v"
+
+	if tag == "" {
+		return fmt.Sprintf(RelEndpoint, a.giteaApi(), a.Name), fmt.Sprintf("%v-gtrel.json", a.shortName)
+	}
+	return fmt.Sprintf(TaggedRelEndpoint, a.giteaApi(), a.Name, url.PathEscape(tag)),
+		fmt.Sprintf("%v-gtrel-%v.json", a.shortName, url.PathEscape(tag))
+}
+
+// giteaTags returns the endpoint and cache file of the repository's tags, newest first
+func (a *Addon) giteaTags() (endpoint, cacheFilename string) {
+	const TagEndpoint = "%v/repos/%v/tags"
+	return fmt.Sprintf(TagEndpoint, a.giteaApi(), a.Name), fmt.Sprintf("%v-gttag.json", a.shortName)
+}
+
+func (a *Addon) getGiteaRelease(ctx context.Context) (*downloadAsset, error) {
+	endpoint, cacheFilename := a.giteaRelease(a.Pin)
+	gtRel, err := fetchJson[giteaRelease](ctx, a, endpoint, cacheFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching update info: %w", err)
+	}
+
+	// gitea assets have no content type, they are matched like github release assets
+	ghRelease := &ghTaggedRel{TagName: gtRel.TagName}
+	for _, gtAsset := range gtRel.Assets {
+		asset := newLinkedAsset(gtAsset.Name, gtAsset.DownloadUrl, gtRel.PublishedAt)
+		asset.Size = gtAsset.Size
+		ghRelease.Assets = append(ghRelease.Assets, asset)
+	}
+	if !slices.ContainsFunc(ghRelease.Assets, func(a *downloadAsset) bool { return a.ContentType == "application/zip" }) {
+		return nil, fmt.Errorf("no zip archive found in release %v", gtRel.TagName)
+	}
+
+	addonReleases, err := a.fetchReleaseManifest(ctx, ghRelease)
+	if err != nil {
+		return nil, err
+	}
+	asset, err := a.findTaggedRel(ghRelease, addonReleases)
+	if err != nil {
+		return nil, err
+	}
+	asset.RelType = GtRel
+
+	return asset, nil
+}
+
+func (a *Addon) getGiteaTag(ctx context.Context) (*downloadAsset, error) {
+	endpoint, cacheFilename := a.giteaTags()
+	gtTags, err := fetchJson[[]giteaTag](ctx, a, endpoint, cacheFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tags: %w", err)
+	}
+
+	tags := *gtTags
+	if a.Pin != "" {
+		idx := slices.IndexFunc(tags, a.isPinnedTag)
+		if idx == -1 {
+			return nil, fmt.Errorf("pinned tag or ref %v not found", a.Pin)
+		}
+		tags = tags[idx : idx+1]
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("did not find valid tag for %v", a.Name)
+	}
+
+	tag := tags[0]
+	name := tag.Name + ".zip"
+	asset := &downloadAsset{
+		Name:        name,
+		DownloadUrl: tag.ZipballUrl,
+		ContentType: "application/zip",
+		RefSha:      "refs/tags/" + tag.Name,
+		Version:     name,
+		RelType:     GtTag,
+	}
+
+	return asset, nil
+}
+
+// isPinnedTag reports if tag is the tag or commit sha (or a prefix of it) in Pin
+func (a *Addon) isPinnedTag(tag giteaTag) bool {
+	return tag.Name == a.Pin || (len(a.Pin) >= 7 && strings.HasPrefix(tag.Commit.Sha, a.Pin))
+}
+
+// parseGiteaName accepts PROJECT/ADDON or a gitea or forgejo repository url, returning
+// PROJECT/ADDON and the api base url of instances other than codeberg
+func parseGiteaName(arg string) (name, apiUrl string, err error) {
+	if !strings.Contains(arg, "://") {
+		return strings.Trim(arg, "/"), "", nil
+	}
+
+	u, err := url.Parse(arg)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("%v is not a gitea repository url", arg)
+	}
+	if !strings.EqualFold(strings.TrimPrefix(u.Host, "www."), "codeberg.org") {
+		apiUrl = fmt.Sprintf("%v://%v/api/v1", u.Scheme, u.Host)
+	}
+
+	// /PROJECT/ADDON/releases => PROJECT, ADDON
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%v is not a gitea repository url", arg)
+	}
+
+	return parts[0] + "/" + strings.TrimSuffix(parts[1], ".git"), apiUrl, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddon_getGiteaRelease(t *testing.T) {
+	const relJson = `{"tag_name": "v2.0.0", "published_at": "2024-06-01T00:00:00Z", "assets": [
+		{"name": "addon-v2.0.0-classic.zip", "size": 10, "browser_download_url": "https://codeberg.org/proj/addon/releases/download/v2.0.0/addon-v2.0.0-classic.zip"},
+		{"name": "addon-v2.0.0.zip", "size": 20, "browser_download_url": "https://codeberg.org/proj/addon/releases/download/v2.0.0/addon-v2.0.0.zip"},
+		{"name": "release.json", "size": 5, "browser_download_url": "https://codeberg.org/proj/addon/releases/download/v2.0.0/release.json"}
+	]}`
+	const manifestJson = `{"releases": [
+		{"version": "2.0.0-classic", "filename": "addon-v2.0.0-classic.zip", "metadata": [{"flavor": "classic", "interface": 11507}]},
+		{"version": "2.0.0", "filename": "addon-v2.0.0.zip", "metadata": [{"flavor": "mainline", "interface": 110105}]}
+	]}`
+	const tagJson = `[
+		{"name": "v2.0.0", "commit": {"sha": "2222222abcdef"}, "zipball_url": "https://codeberg.org/proj/addon/archive/v2.0.0.zip"},
+		{"name": "v1.0.0", "commit": {"sha": "1111111abcdef"}, "zipball_url": "https://codeberg.org/proj/addon/archive/v1.0.0.zip"}
+	]`
+
+	tests := []struct {
+		name    string
+		relType GhRelType
+		flavor  string
+		pin     string
+		url     string
+		version string
+		refSha  string
+	}{
+		{"mainline release", GtRel, "", "", "https://codeberg.org/proj/addon/releases/download/v2.0.0/addon-v2.0.0.zip", "2.0.0", ""},
+		{"classic release", GtRel, FlavorClassic, "", "https://codeberg.org/proj/addon/releases/download/v2.0.0/addon-v2.0.0-classic.zip", "2.0.0-classic", ""},
+		{"latest tag", GtTag, "", "", "https://codeberg.org/proj/addon/archive/v2.0.0.zip", "v2.0.0.zip", "refs/tags/v2.0.0"},
+		{"pinned tag", GtTag, "", "v1.0.0", "https://codeberg.org/proj/addon/archive/v1.0.0.zip", "v1.0.0.zip", "refs/tags/v1.0.0"},
+		{"pinned sha", GtTag, "", "1111111", "https://codeberg.org/proj/addon/archive/v1.0.0.zip", "v1.0.0.zip", "refs/tags/v1.0.0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			testWriteFile(t, cacheDir+"/addon-gtrel.json", relJson)
+			testWriteFile(t, cacheDir+"/addon-addonRel.json", manifestJson)
+			testWriteFile(t, cacheDir+"/addon-gttag.json", tagJson)
+
+			inst := &Installation{Flavor: tc.flavor}
+			addon := &Addon{Name: "proj/addon", RelType: tc.relType, Pin: tc.pin}
+			if err := inst.initializeAddon(addon, nil); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			testSharedState(t, addon, cacheDir, t.TempDir())
+
+			asset, err := addon.checkUpdate(t.Context())
+			if err != nil {
+				t.Fatalf("error finding gitea release: %v", err)
+			}
+			testEq(t, "DownloadUrl", asset.DownloadUrl, tc.url)
+			testEq(t, "Version", asset.Version, tc.version)
+			testEq(t, "RefSha", asset.RefSha, tc.refSha)
+			testEq(t, "RelType", asset.RelType, tc.relType)
+		})
+	}
+}
+
+func TestAddon_update_giteaTagPin(t *testing.T) {
+	const tagJson = `[
+		{"name": "v2.0.0", "commit": {"sha": "2222222abcdef"}, "zipball_url": "http://%[1]v/archive/v2.0.0.zip"},
+		{"name": "v1.0.0", "commit": {"sha": "1111111abcdef"}, "zipball_url": "http://%[1]v/archive/v1.0.0.zip"}
+	]`
+	const etag = `"tags"`
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/repos/proj/addon/tags", func(w http.ResponseWriter, r *http.Request) {
+		// tags never change, so every conditional request is answered with a 304
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, tagJson, r.Host)
+	})
+	mux.HandleFunc("/archive/{tag}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testZip(t, testZipEntry{name: "Addon/Addon.toc", data: r.PathValue("tag")}))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	addonsDir := t.TempDir()
+	addon := &Addon{Name: "proj/addon", RelType: GtTag, ApiUrl: srv.URL + "/api"}
+	if err := newAddonManager().initializeAddon(addon, nil); err != nil {
+		t.Fatalf("error initializing addon: %v", err)
+	}
+	testSharedState(t, addon, "", addonsDir)
+
+	tests := []struct {
+		name      string
+		pin       string
+		hasUpdate bool
+		refSha    string
+	}{
+		{"new addon", "", true, "refs/tags/v2.0.0"},
+		{"up to date", "", false, "refs/tags/v2.0.0"},
+		{"pinned", "v1.0.0", true, "refs/tags/v1.0.0"},
+		{"up to date pinned", "v1.0.0", false, "refs/tags/v1.0.0"},
+		{"unpinned", "", true, "refs/tags/v2.0.0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			addon.Pin = tc.pin
+			addon.validators = map[string]*httpValidators{}
+
+			status := addon.update(t.Context())
+			if status.err != nil {
+				t.Fatalf("error updating addon: %v", status.err)
+			}
+			testEq(t, "hasUpdate", status.hasUpdate, tc.hasUpdate)
+			testEq(t, "RefSha", addon.RefSha, tc.refSha)
+			testEq(t, "has validators", addon.HttpValidators[srv.URL+"/api/repos/proj/addon/tags"] != nil, true)
+			testEq(t, "Addon/Addon.toc", testReadFile(t, addonsDir+"/Addon/Addon.toc"), tc.refSha[len("refs/tags/"):]+".zip")
+		})
+	}
+}
+
+func TestParseGiteaName(t *testing.T) {
+	tests := []struct {
+		input  string
+		name   string
+		apiUrl string
+	}{
+		{"proj/addon", "proj/addon", ""},
+		{"https://codeberg.org/proj/addon", "proj/addon", ""},
+		{"https://codeberg.org/proj/addon/releases/tag/v1.0.0", "proj/addon", ""},
+		{"https://git.example.com/proj/addon.git", "proj/addon", "https://git.example.com/api/v1"},
+		{"https://codeberg.org/proj", "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			name, apiUrl, err := parseGiteaName(tc.input)
+			if tc.name == "" {
+				if err == nil {
+					t.Errorf("expected error parsing %v, got %v", tc.input, name)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("error parsing gitea repository: %v", err)
+				return
+			}
+			testEq(t, "name", name, tc.name)
+			testEq(t, "apiUrl", apiUrl, tc.apiUrl)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const gitlabApiUrl = "https://gitlab.com/api/v4"
+
+type glRelease struct {
+	TagName    string    `json:"tag_name"`
+	ReleasedAt time.Time `json:"released_at"`
+	Assets     struct {
+		// archives of the repository generated by gitlab
+		Sources []struct {
+			Format string
+			Url    string
+		}
+		// files attached to the release
+		Links []struct {
+			Name           string
+			Url            string
+			DirectAssetUrl string `json:"direct_asset_url"`
+		}
+	}
+}
+
+// gitlabApi returns the api base url for gitlab releases, ApiUrl or gitlab.com
+func (a *Addon) gitlabApi() string {
+	if a.ApiUrl == "" {
+		return gitlabApiUrl
+	}
+	return strings.TrimSuffix(a.ApiUrl, "/")
+}
+
+// gitlabRelease returns the endpoint and cache file of the latest release, or of the release
+// tagged tag if set
+func (a *Addon) gitlabRelease(tag string) (endpoint, cacheFilename string) {
+	const RelEndpoint = "%v/projects/%v/releases/permalink/latest"
+	const TaggedRelEndpoint = "%v/projects/%v/releases/%v"
+
+	// PROJECT/ADDON => PROJECT%2FADDON, gitlab projects can also be nested in subgroups
+	project := url.PathEscape(a.Name)
+	if tag == "" {
+		return fmt.Sprintf(RelEndpoint, a.gitlabApi(), project), fmt.Sprintf("%v-glrel.json", a.shortName)
+	}
+	return fmt.Sprintf(TaggedRelEndpoint, a.gitlabApi(), project, url.PathEscape(tag)),
+		fmt.Sprintf("%v-glrel-%v.json", a.shortName, url.PathEscape(tag))
+}
+
+func (a *Addon) getGitlabRelease(ctx context.Context) (*downloadAsset, error) {
+	endpoint, cacheFilename := a.gitlabRelease(a.Pin)
+	glRel, err := fetchJson[glRelease](ctx, a, endpoint, cacheFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching update info: %w", err)
+	}
+
+	// attached files are matched like github release assets, release links have no content type
+	ghRelease := &ghTaggedRel{TagName: glRel.TagName}
+	for _, link := range glRel.Assets.Links {
+		downloadUrl := link.DirectAssetUrl
+		if downloadUrl == "" {
+			downloadUrl = link.Url
+		}
+		// link names are display names, the file name is needed to match release.json
+		name := link.Name
+		if u, err := url.Parse(downloadUrl); err == nil && path.Ext(u.Path) != "" {
+			name = path.Base(u.Path)
+		}
+		ghRelease.Assets = append(ghRelease.Assets, newLinkedAsset(name, downloadUrl, glRel.ReleasedAt))
+	}
+
+	if !slices.ContainsFunc(ghRelease.Assets, func(a *downloadAsset) bool { return a.ContentType == "application/zip" }) {
+		// releases without attached archives are installed from the generated source archive
+		for _, source := range glRel.Assets.Sources {
+			if source.Format == "zip" {
+				return &downloadAsset{
+					Name:        fmt.Sprintf("%v-%v.zip", a.shortName, glRel.TagName),
+					DownloadUrl: source.Url,
+					ContentType: "application/zip",
+					UpdatedAt:   glRel.ReleasedAt,
+					Version:     glRel.TagName,
+					RelType:     GlRel,
+				}, nil
+			}
+		}
+		return nil, fmt.Errorf("no zip archive found in release %v", glRel.TagName)
+	}
+
+	addonReleases, err := a.fetchReleaseManifest(ctx, ghRelease)
+	if err != nil {
+		return nil, err
+	}
+	asset, err := a.findTaggedRel(ghRelease, addonReleases)
+	if err != nil {
+		return nil, err
+	}
+	asset.RelType = GlRel
+
+	return asset, nil
+}
+
+// parseGitlabName accepts PROJECT/ADDON or a gitlab project url, returning PROJECT/ADDON and the
+// api base url of self-hosted instances. projects can be nested in subgroups, GROUP/SUBGROUP/ADDON
+func parseGitlabName(arg string) (name, apiUrl string, err error) {
+	if !strings.Contains(arg, "://") {
+		return strings.Trim(arg, "/"), "", nil
+	}
+
+	u, err := url.Parse(arg)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("%v is not a gitlab project url", arg)
+	}
+	if !strings.EqualFold(strings.TrimPrefix(u.Host, "www."), "gitlab.com") {
+		apiUrl = fmt.Sprintf("%v://%v/api/v4", u.Scheme, u.Host)
+	}
+
+	// /GROUP/ADDON/-/releases => GROUP/ADDON
+	name, _, _ = strings.Cut(strings.Trim(u.Path, "/"), "/-/")
+	name = strings.TrimSuffix(strings.Trim(name, "/"), ".git")
+	if !strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("%v is not a gitlab project url", arg)
+	}
+
+	return name, apiUrl, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAddon_getGitlabRelease(t *testing.T) {
+	const relJson = `{"tag_name": "v2.0.0", "released_at": "2024-06-01T00:00:00Z", "assets": {
+		"sources": [{"format": "tar.gz", "url": "https://gitlab.com/proj/addon/-/archive/v2.0.0/addon-v2.0.0.tar.gz"},
+			{"format": "zip", "url": "https://gitlab.com/proj/addon/-/archive/v2.0.0/addon-v2.0.0.zip"}],
+		"links": [
+			{"name": "Classic", "url": "https://gitlab.com/proj/addon/-/releases/v2.0.0/downloads/addon-v2.0.0-classic.zip"},
+			{"name": "Retail", "url": "https://gitlab.com/proj/addon/-/package_files/1/download",
+				"direct_asset_url": "https://gitlab.com/proj/addon/-/releases/v2.0.0/downloads/addon-v2.0.0.zip"},
+			%v
+		]}}`
+	const manifestLink = `{"name": "release.json", "url": "https://gitlab.com/proj/addon/-/releases/v2.0.0/downloads/release.json"}`
+	const sourceRelJson = `{"tag_name": "v1.0.0", "released_at": "2024-05-01T00:00:00Z", "assets": {
+		"sources": [{"format": "zip", "url": "https://gitlab.com/proj/addon/-/archive/v1.0.0/addon-v1.0.0.zip"}],
+		"links": [{"name": "notes", "url": "https://gitlab.com/proj/addon/-/wikis/notes"}]}}`
+	const manifestJson = `{"releases": [{"version": "2.0.0", "filename": "addon-v2.0.0-classic.zip",
+		"metadata": [{"flavor": "classic", "interface": 11507}]}]}`
+
+	tests := []struct {
+		name    string
+		relJson string
+		flavor  string
+		pin     string
+		asset   string
+		url     string
+		version string
+	}{
+		{"mainline link", fmt.Sprintf(relJson, "{}"), "", "", "addon-v2.0.0.zip",
+			"https://gitlab.com/proj/addon/-/releases/v2.0.0/downloads/addon-v2.0.0.zip", "v2.0.0"},
+		{"release.json", fmt.Sprintf(relJson, manifestLink), FlavorClassic, "", "addon-v2.0.0-classic.zip",
+			"https://gitlab.com/proj/addon/-/releases/v2.0.0/downloads/addon-v2.0.0-classic.zip", "2.0.0"},
+		{"source archive", sourceRelJson, "", "", "addon-v1.0.0.zip",
+			"https://gitlab.com/proj/addon/-/archive/v1.0.0/addon-v1.0.0.zip", "v1.0.0"},
+		{"pinned", sourceRelJson, "", "v1.0.0", "addon-v1.0.0.zip",
+			"https://gitlab.com/proj/addon/-/archive/v1.0.0/addon-v1.0.0.zip", "v1.0.0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			relFile := "addon-glrel.json"
+			if tc.pin != "" {
+				relFile = "addon-glrel-" + tc.pin + ".json"
+			}
+			testWriteFile(t, cacheDir+"/"+relFile, tc.relJson)
+			testWriteFile(t, cacheDir+"/addon-addonRel.json", manifestJson)
+
+			inst := &Installation{Flavor: tc.flavor}
+			addon := &Addon{Name: "proj/addon", RelType: GlRel, Pin: tc.pin}
+			if err := inst.initializeAddon(addon, nil); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			testSharedState(t, addon, cacheDir, t.TempDir())
+
+			asset, err := addon.checkUpdate(t.Context())
+			if err != nil {
+				t.Fatalf("error finding gitlab release: %v", err)
+			}
+			testEq(t, "Name", asset.Name, tc.asset)
+			testEq(t, "DownloadUrl", asset.DownloadUrl, tc.url)
+			testEq(t, "Version", asset.Version, tc.version)
+			testEq(t, "RelType", asset.RelType, GlRel)
+		})
+	}
+}
+
+func TestAddon_gitlabRelease(t *testing.T) {
+	tests := []struct {
+		name     string
+		addon    *Addon
+		tag      string
+		expected string
+	}{
+		{"latest", &Addon{Name: "proj/addon"}, "",
+			"https://gitlab.com/api/v4/projects/proj%2Faddon/releases/permalink/latest"},
+		{"subgroup", &Addon{Name: "group/sub/addon"}, "",
+			"https://gitlab.com/api/v4/projects/group%2Fsub%2Faddon/releases/permalink/latest"},
+		{"tagged", &Addon{Name: "proj/addon"}, "v1.0/beta",
+			"https://gitlab.com/api/v4/projects/proj%2Faddon/releases/v1.0%2Fbeta"},
+		{"self-hosted", &Addon{Name: "proj/addon", ApiUrl: "https://git.example.com/api/v4/"}, "",
+			"https://git.example.com/api/v4/projects/proj%2Faddon/releases/permalink/latest"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint, _ := tc.addon.gitlabRelease(tc.tag)
+			testEq(t, "endpoint", endpoint, tc.expected)
+		})
+	}
+}
+
+func TestParseGitlabName(t *testing.T) {
+	tests := []struct {
+		input  string
+		name   string
+		apiUrl string
+	}{
+		{"proj/addon", "proj/addon", ""},
+		{"https://gitlab.com/proj/addon", "proj/addon", ""},
+		{"https://gitlab.com/group/sub/addon/-/releases", "group/sub/addon", ""},
+		{"https://git.example.com/proj/addon.git", "proj/addon", "https://git.example.com/api/v4"},
+		{"https://gitlab.com/addon", "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			name, apiUrl, err := parseGitlabName(tc.input)
+			if tc.name == "" {
+				if err == nil {
+					t.Errorf("expected error parsing %v, got %v", tc.input, name)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("error parsing gitlab project: %v", err)
+				return
+			}
+			testEq(t, "name", name, tc.name)
+			testEq(t, "apiUrl", apiUrl, tc.apiUrl)
+		})
+	}
+}
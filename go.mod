@@ -1,3 +1,3 @@
 module wow-addon-updater
 
-go 1.24
+go 1.25
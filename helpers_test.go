@@ -1,6 +1,13 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"slices"
 	"testing"
 	"time"
@@ -59,3 +66,117 @@ func testDownloadAssetEq(t *testing.T, i, e *downloadAsset) {
 	testEq(t, "Version", i.Version, e.Version)
 	testEq(t, "RelType", i.RelType, e.RelType)
 }
+
+// testSharedState sets up addon to run outside of AddonManager.runAddonTasks. downloads are read
+// from (or cached to) cacheDir if set, addons are extracted to addonsDir and logs are discarded
+func testSharedState(t *testing.T, addon *Addon, cacheDir, addonsDir string) {
+	t.Helper()
+
+	var cacheRoot *os.Root
+	if cacheDir != "" {
+		var err error
+		if cacheRoot, err = os.OpenRoot(cacheDir); err != nil {
+			t.Fatalf("error opening cache dir: %v", err)
+		}
+	}
+	addonsRoot, err := os.OpenRoot(addonsDir)
+	if err != nil {
+		t.Fatalf("error opening addons dir: %v", err)
+	}
+	netTasks, netCancel := spawnTaskPool(1, 1)
+	diskTasks, diskCancel := spawnTaskPool(2, 2)
+	logs := make(chan string)
+	go func() {
+		for range logs {
+		}
+	}()
+
+	addon.addonSharedState = &addonSharedState{
+		buf:        &bytes.Buffer{},
+		cacheDir:   cacheRoot,
+		addonsDir:  addonsRoot,
+		client:     newHttpClient(),
+		validators: map[string]*httpValidators{},
+		netTasks:   netTasks,
+		diskTasks:  diskTasks,
+		logs:       logs,
+	}
+	t.Cleanup(func() {
+		addon.addonSharedState = nil
+		netCancel()
+		diskCancel()
+		close(logs)
+		if cacheRoot != nil {
+			cacheRoot.Close()
+		}
+		addonsRoot.Close()
+	})
+}
+
+func testWriteFile(t *testing.T, filename string, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatalf("error creating dir for %v: %v", filename, err)
+	}
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatalf("error writing %v: %v", filename, err)
+	}
+}
+
+type testZipEntry struct {
+	name, data string
+	// file mode, regular file if 0
+	mode fs.FileMode
+	// store an incorrect checksum so reading the entry fails
+	badCrc bool
+}
+
+func testZip(t *testing.T, entries ...testZipEntry) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	zipW := zip.NewWriter(buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Store}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+
+		var err error
+		if entry.badCrc {
+			header.CRC32 = crc32.ChecksumIEEE([]byte(entry.data)) + 1
+			header.CompressedSize64 = uint64(len(entry.data))
+			header.UncompressedSize64 = uint64(len(entry.data))
+			w, err2 := zipW.CreateRaw(header)
+			if err = err2; err == nil {
+				_, err = w.Write([]byte(entry.data))
+			}
+		} else {
+			w, err2 := zipW.CreateHeader(header)
+			if err = err2; err == nil {
+				_, err = w.Write([]byte(entry.data))
+			}
+		}
+		if err != nil {
+			t.Fatalf("error writing zip entry %v: %v", entry.name, err)
+		}
+	}
+	if err := zipW.Close(); err != nil {
+		t.Fatalf("error writing zip: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// testReadFile returns the contents of filename, or "<missing>" if it does not exist
+func testReadFile(t *testing.T, filename string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "<missing>"
+	} else if err != nil {
+		t.Fatalf("error reading %v: %v", filename, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var errAddonNotFound = errors.New("addon not found")
+
+// Installation is a wow client with its own AddOns folder, game flavor and addons
+type Installation struct {
+	// name used to select the installation from the cli, optional for the default installation
+	Name   string `json:",omitempty"`
+	Addons []*Addon
+	// map of addon name to update info, only used when (de)serializing. most likely should use
+	// Addon.AddonUpdateInfo instead
+	UpdateInfo map[string]*AddonUpdateInfo
+	// game flavor to install addons for: mainline (default), classic (classic era), bcc, wrath,
+	// cata or mists
+	Flavor string `json:",omitempty"`
+	// wow AddOns folder addons are installed to. required for additional installations unless
+	// CacheDir is set. the default installation defaults to the working directory
+	AddonsDir string `json:",omitempty"`
+	// client interface version, eg 110105 for 11.1.5. detected from the client's .build.info if not
+	// set, releases and installed tocs are checked against it
+	Interface int `json:",omitempty"`
+	// Interface or the detected interface version, 0 if unknown
+	iface         int
+	ifaceResolved bool
+	// update info of addons no longer in Addons, dropped from UpdateInfo on load
+	droppedInfo map[string]*AddonUpdateInfo
+	// AddonsDir or its default, can be overridden from the cli without changing the config
+	addonsDir  string
+	addonsRoot *os.Root
+	// addonsDir is a dev dir inside CacheDir and is created if missing
+	devAddonsDir bool
+}
+
+// displayName is the name of the installation shown to the user
+func (inst *Installation) displayName() string {
+	return cmp.Or(inst.Name, "default")
+}
+
+// initialize validates the installation and its addons. addonsDir defaults to a dir inside
+// cacheDir in dev, or the working directory for the default installation
+func (inst *Installation) initialize(cacheDir string, isDefault bool) error {
+	if err := validFlavor(inst.Flavor); err != nil {
+		return err
+	}
+
+	// rebuild updateInfo with only currently tracked addons
+	prevUpdateInfo := inst.UpdateInfo
+	inst.UpdateInfo = make(map[string]*AddonUpdateInfo, len(inst.Addons))
+
+	for _, addon := range inst.Addons {
+		if _, ok := inst.UpdateInfo[addon.Name]; ok {
+			return fmt.Errorf("duplicate addon found: %v", addon.Name)
+		}
+		if err := inst.initializeAddon(addon, prevUpdateInfo[addon.Name]); err != nil {
+			return fmt.Errorf("error loading addon %v: %w", addon.Name, err)
+		}
+		inst.UpdateInfo[addon.Name] = addon.AddonUpdateInfo
+	}
+
+	inst.droppedInfo = map[string]*AddonUpdateInfo{}
+	for name, info := range prevUpdateInfo {
+		if _, ok := inst.UpdateInfo[name]; !ok && info != nil && len(info.ExtractedDirs) != 0 {
+			inst.droppedInfo[name] = info
+		}
+	}
+
+	inst.addonsDir, inst.devAddonsDir = inst.AddonsDir, false
+	if inst.addonsDir == "" {
+		switch {
+		case cacheDir != "" && isDefault:
+			inst.addonsDir, inst.devAddonsDir = cacheDir+"/addons", true
+		case cacheDir != "":
+			inst.addonsDir, inst.devAddonsDir = cacheDir+"/addons-"+inst.Name, true
+		case isDefault:
+			inst.addonsDir = "."
+		default:
+			return fmt.Errorf("AddonsDir is required")
+		}
+	}
+
+	return nil
+}
+
+// resolveInterface sets the client interface version addons are checked against, detecting it
+// from .build.info if Interface is not set. must be called before running addon tasks
+func (inst *Installation) resolveInterface() int {
+	if inst.ifaceResolved {
+		return inst.iface
+	}
+	inst.ifaceResolved = true
+
+	inst.iface = inst.Interface
+	if inst.iface == 0 {
+		// most AddonsDirs outside of a wow install, eg in dev, will not have a .build.info
+		inst.iface, _ = detectInterface(inst.addonsDir)
+	}
+
+	return inst.iface
+}
+
+// openAddonsDir opens the AddOns folder, creating it if it is a dev dir inside CacheDir
+func (inst *Installation) openAddonsDir() (*os.Root, error) {
+	if inst.addonsRoot != nil {
+		return inst.addonsRoot, nil
+	}
+
+	if inst.devAddonsDir {
+		if err := os.MkdirAll(inst.addonsDir, 0755); err != nil {
+			return nil, fmt.Errorf("could not create addons dir: %w", err)
+		}
+	}
+
+	root, err := os.OpenRoot(inst.addonsDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not open addons dir: %w", err)
+	}
+	inst.addonsRoot = root
+
+	return root, nil
+}
+
+func (inst *Installation) initializeAddon(addon *Addon, lastUpdateInfo *AddonUpdateInfo) error {
+	if addon.RelType >= GhEnd {
+		return fmt.Errorf("unknown release type for addon %v: %v", addon.Name, addon.RelType)
+	}
+
+	// // convenience to skip addons with a leading -, ie "-PROJECT/ADDON" is skipped
+	// if addon.Name[0] == '-' {
+	// 	addon.Skip = true
+	// 	addon.Name = addon.Name[1:]
+	// }
+
+	// update projName and shortname
+	// addon.Name = "PROJECT/ADDON"; projName, shortName = "PROJECT/", "ADDON"
+	// addon.Name = "GROUP/SUBGROUP/ADDON"; projName, shortName = "GROUP/SUBGROUP/", "ADDON"
+	idx := strings.LastIndexByte(addon.Name, '/')
+	if idx <= 0 || idx == len(addon.Name)-1 {
+		return fmt.Errorf("addon name not formatted correctly: expected PROJECT/ADDON, found %v", addon.Name)
+	}
+	addon.projName = addon.Name[:idx+1]
+	addon.shortName = addon.Name[idx+1:]
+	addon.install = inst
+	addon.flavor = inst.Flavor
+	if _, err := strconv.Atoi(addon.projectId()); (addon.RelType == CfRel || addon.RelType == WiRel) && err != nil {
+		return fmt.Errorf("project id must be a number, found %v", addon.projectId())
+	}
+	if addon.Pin != "" && !addon.RelType.pinnable() {
+		return fmt.Errorf("addons of release type %v cannot be pinned, only the latest release can be downloaded", addon.RelType)
+	}
+
+	if err := validCompat(addon.Compat); err != nil {
+		return err
+	}
+	if addon.ApiUrl != "" {
+		if u, err := url.Parse(addon.ApiUrl); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("ApiUrl must be an http(s) url, found %v", addon.ApiUrl)
+		}
+	}
+	if err := validChannel(addon.Channel); err != nil {
+		return err
+	}
+
+	// set AddonUpdateInfo, creating it if not found
+	if lastUpdateInfo == nil {
+		lastUpdateInfo = &AddonUpdateInfo{}
+	}
+	addon.AddonUpdateInfo = lastUpdateInfo
+
+	// populate addon.{include,exclude}Dirs from Dirs
+	// dirs starting with '-' are excluded
+	for i, dir := range addon.Dirs {
+		// ensure dir names have a trailing '/'
+		if dir[len(dir)-1] != '/' {
+			dir += "/"
+			addon.Dirs[i] = dir
+		}
+
+		if dir[0] == '-' {
+			addon.excludeDirs = append(addon.excludeDirs, dir[1:])
+		} else {
+			addon.includeDirs = append(addon.includeDirs, dir)
+		}
+	}
+
+	return nil
+}
+
+// findAddon looks up a tracked addon by its full name (PROJECT/ADDON) or short name (ADDON).
+// names are case-insensitive
+func (inst *Installation) findAddon(name string) (*Addon, error) {
+	var found *Addon
+	for _, addon := range inst.Addons {
+		if strings.EqualFold(addon.Name, name) {
+			return addon, nil
+		}
+		if !strings.EqualFold(addon.shortName, name) {
+			continue
+		}
+
+		if found != nil {
+			return nil, fmt.Errorf("addon name %v is ambiguous: matches %v and %v", name, found.Name, addon.Name)
+		}
+		found = addon
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: %v", errAddonNotFound, name)
+	}
+	return found, nil
+}
+
+// addAddon validates and starts tracking a new addon
+func (inst *Installation) addAddon(addon *Addon) error {
+	if _, ok := inst.UpdateInfo[addon.Name]; ok {
+		return fmt.Errorf("duplicate addon found: %v", addon.Name)
+	}
+	if err := inst.initializeAddon(addon, nil); err != nil {
+		return fmt.Errorf("error loading addon %v: %w", addon.Name, err)
+	}
+
+	inst.Addons = append(inst.Addons, addon)
+	inst.UpdateInfo[addon.Name] = addon.AddonUpdateInfo
+
+	return nil
+}
+
+// parseAddonName accepts PROJECT/ADDON or a github repo url, returning PROJECT/ADDON
+func parseAddonName(arg string) (string, error) {
+	// git@github.com:PROJECT/ADDON.git
+	if rest, ok := strings.CutPrefix(arg, "git@github.com:"); ok {
+		arg = "github.com/" + rest
+	}
+	if repo := githubRepo(arg); repo != "" {
+		return repo, nil
+	} else if strings.Contains(arg, "://") || strings.Contains(arg, ".com/") {
+		return "", fmt.Errorf("%v is not a github repository", arg)
+	}
+
+	return strings.Trim(arg, "/"), nil
+}
+
+// removeAddon stops tracking addon, dropping its update info
+func (inst *Installation) removeAddon(addon *Addon) {
+	inst.Addons = slices.DeleteFunc(inst.Addons, func(a *Addon) bool { return a == addon })
+	delete(inst.UpdateInfo, addon.Name)
+}
+
+// uninstallAddon deletes the folders installed by addon, except folders shared with other addons,
+// and its previous versions and stops tracking it. keepFiles only stops tracking addon
+func (inst *Installation) uninstallAddon(addon *Addon, keepFiles bool) error {
+	if !keepFiles && len(addon.ExtractedDirs) != 0 {
+		root, err := inst.openAddonsDir()
+		if err != nil {
+			return err
+		}
+
+		owners := newFolderOwners(inst.Addons, "")
+		for _, dir := range addon.ExtractedDirs {
+			if len(owners.others(addon.Name, dir)) != 0 {
+				continue
+			}
+			if err := root.RemoveAll(dir); err != nil {
+				return fmt.Errorf("error removing %v: %w", dir, err)
+			}
+		}
+		if err := root.RemoveAll(generationsDir + "/" + addonDirName(addon.Name)); err != nil {
+			return fmt.Errorf("error removing previous versions: %w", err)
+		}
+	}
+
+	inst.removeAddon(addon)
+	return nil
+}
+
+// orphanedUpdateInfo returns the folders still on disk of addons that were removed from Addons
+// without being uninstalled, keyed by addon name. folders now owned by other addons are omitted
+func (inst *Installation) orphanedUpdateInfo() (map[string][]string, error) {
+	if len(inst.droppedInfo) == 0 {
+		return nil, nil
+	}
+	installed, err := inst.installedDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := newFolderOwners(inst.Addons, "")
+	orphaned := map[string][]string{}
+	for name, info := range inst.droppedInfo {
+		for _, dir := range info.ExtractedDirs {
+			if installed[strings.ToLower(dir)] && len(owners.others(name, dir)) == 0 {
+				orphaned[name] = append(orphaned[name], dir)
+			}
+		}
+	}
+
+	return orphaned, nil
+}
+
+// readMissingTocs parses the tocs of installed addons that were updated before tocs were tracked
+func (inst *Installation) readMissingTocs(addons []*Addon) error {
+	addons = slices.DeleteFunc(slices.Clone(addons), func(a *Addon) bool {
+		return a.install != inst || a.Toc != nil || len(a.ExtractedDirs) == 0
+	})
+	if len(addons) == 0 {
+		return nil
+	}
+
+	root, err := inst.openAddonsDir()
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, addon := range addons {
+		tocs, err := readTocs(root, addon.ExtractedDirs, addon.flavor)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", addon.Name, err))
+		}
+		addon.Toc = tocs
+	}
+
+	return errors.Join(errs...)
+}
+
+func (inst *Installation) String() string {
+	buf := &strings.Builder{}
+
+	fmt.Fprintln(buf, "Installation:", inst.displayName())
+	fmt.Fprintln(buf, "AddonsDir:   ", inst.addonsDir)
+	fmt.Fprintln(buf, "Flavor:      ", cmp.Or(inst.Flavor, FlavorMainline))
+	fmt.Fprintln(buf, "Interface:   ", inst.resolveInterface())
+	fmt.Fprintln(buf)
+
+	for _, addon := range inst.Addons {
+		fmt.Fprintln(buf, addon)
+	}
+
+	return buf.String()
+}
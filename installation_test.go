@@ -0,0 +1,109 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInstallation_uninstallAddon(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepFiles bool
+		// expected A/A.toc after removing proj/a, Lib is shared with proj/b and always kept
+		a string
+	}{
+		{"delete files", false, "<missing>"},
+		{"keep files", true, "a"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			addonsDir := t.TempDir()
+			testWriteFile(t, addonsDir+"/A/A.toc", "a")
+			testWriteFile(t, addonsDir+"/Lib/Lib.toc", "lib")
+			testWriteFile(t, addonsDir+"/B/B.toc", "b")
+
+			inst := &Installation{
+				AddonsDir: addonsDir,
+				Addons:    []*Addon{{Name: "proj/a"}, {Name: "proj/b"}},
+				UpdateInfo: map[string]*AddonUpdateInfo{
+					"proj/a": {ExtractedDirs: []string{"A", "Lib"}},
+					"proj/b": {ExtractedDirs: []string{"B", "Lib"}},
+				},
+			}
+			if err := inst.initialize("", true); err != nil {
+				t.Fatalf("error initializing installation: %v", err)
+			}
+
+			if err := inst.uninstallAddon(inst.Addons[0], tc.keepFiles); err != nil {
+				t.Fatalf("error removing addon: %v", err)
+			}
+
+			testEq(t, "addons", len(inst.Addons), 1)
+			testEq(t, "updateInfo", len(inst.UpdateInfo), 1)
+			testEq(t, "A/A.toc", testReadFile(t, addonsDir+"/A/A.toc"), tc.a)
+			testEq(t, "Lib/Lib.toc", testReadFile(t, addonsDir+"/Lib/Lib.toc"), "lib")
+			testEq(t, "B/B.toc", testReadFile(t, addonsDir+"/B/B.toc"), "b")
+		})
+	}
+}
+
+func TestInstallation_orphanedUpdateInfo(t *testing.T) {
+	addonsDir := t.TempDir()
+	testWriteFile(t, addonsDir+"/A/A.toc", "a")
+	testWriteFile(t, addonsDir+"/Lib/Lib.toc", "lib")
+
+	// proj/a and proj/c were deleted from Addons by hand
+	inst := &Installation{
+		AddonsDir: addonsDir,
+		Addons:    []*Addon{{Name: "proj/b"}},
+		UpdateInfo: map[string]*AddonUpdateInfo{
+			"proj/a": {ExtractedDirs: []string{"A", "Lib", "Missing"}},
+			"proj/b": {ExtractedDirs: []string{"B", "Lib"}},
+			"proj/c": {ExtractedDirs: []string{"C"}},
+		},
+	}
+	if err := inst.initialize("", true); err != nil {
+		t.Fatalf("error initializing installation: %v", err)
+	}
+	testEq(t, "updateInfo", len(inst.UpdateInfo), 1)
+
+	orphaned, err := inst.orphanedUpdateInfo()
+	if err != nil {
+		t.Fatalf("error finding orphaned update info: %v", err)
+	}
+	testEq(t, "orphaned", len(orphaned), 1)
+	testEqFunc(t, "proj/a", orphaned["proj/a"], []string{"A"}, slices.Equal)
+}
+
+func TestParseAddonName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"BigWigsMods/BigWigs", "BigWigsMods/BigWigs"},
+		{"https://github.com/BigWigsMods/BigWigs", "BigWigsMods/BigWigs"},
+		{"https://github.com/kesava-wow/kuinameplates2/releases/latest", "kesava-wow/kuinameplates2"},
+		{"github.com/WeakAuras/WeakAuras2.git", "WeakAuras/WeakAuras2"},
+		{"git@github.com:WeakAuras/WeakAuras2.git", "WeakAuras/WeakAuras2"},
+		{"https://gitlab.com/proj/addon", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			name, err := parseAddonName(tc.input)
+			if tc.expected == "" {
+				if err == nil {
+					t.Errorf("expected error parsing %v, got %v", tc.input, name)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("error parsing addon name: %v", err)
+				return
+			}
+			testEq(t, "name", name, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// compatibility policies for releases that do not support the client's interface version
+const (
+	CompatWarn   = "warn" // install anyway and print a warning (default)
+	CompatRefuse = "refuse"
+	CompatIgnore = "ignore"
+)
+
+// buildInfoProducts maps the client folder containing Interface/AddOns to its product in .build.info
+var buildInfoProducts = map[string]string{
+	"_retail_":           "wow",
+	"_ptr_":              "wowt",
+	"_xptr_":             "wowxptr",
+	"_beta_":             "wow_beta",
+	"_classic_":          "wow_classic",
+	"_classic_ptr_":      "wow_classic_ptr",
+	"_classic_beta_":     "wow_classic_beta",
+	"_classic_era_":      "wow_classic_era",
+	"_classic_era_ptr_":  "wow_classic_era_ptr",
+	"_anniversary_":      "wow_anniversary",
+	"_classic_era_beta_": "wow_classic_era_beta",
+}
+
+// detectInterface reads the client's interface version from .build.info, expecting addonsDir to be
+// WOW/_retail_/Interface/AddOns
+func detectInterface(addonsDir string) (int, error) {
+	addonsDir, err := filepath.Abs(addonsDir)
+	if err != nil {
+		return 0, err
+	}
+	clientDir := filepath.Dir(filepath.Dir(addonsDir))
+
+	file, err := os.Open(filepath.Join(filepath.Dir(clientDir), ".build.info"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return parseBuildInfo(file, buildInfoProducts[filepath.Base(clientDir)])
+}
+
+// parseBuildInfo finds the interface version of product in a .build.info file. .build.info is a
+// '|' separated table with a header row of NAME!TYPE:SIZE columns. if product is empty the only
+// active build is used
+func parseBuildInfo(rd io.Reader, product string) (int, error) {
+	scanner := bufio.NewScanner(rd)
+	if !scanner.Scan() {
+		return 0, fmt.Errorf("empty build info")
+	}
+
+	columns := map[string]int{}
+	for i, column := range strings.Split(scanner.Text(), "|") {
+		name, _, _ := strings.Cut(column, "!")
+		columns[name] = i
+	}
+	activeIdx, okActive := columns["Active"]
+	versionIdx, okVersion := columns["Version"]
+	productIdx, okProduct := columns["Product"]
+	if !okActive || !okVersion || !okProduct {
+		return 0, fmt.Errorf("build info missing Active, Version or Product")
+	}
+
+	versions := []string{}
+	for scanner.Scan() {
+		row := strings.Split(scanner.Text(), "|")
+		if len(row) <= max(activeIdx, versionIdx, productIdx) || row[activeIdx] != "1" {
+			continue
+		}
+		if product == "" || row[productIdx] == product {
+			versions = append(versions, row[versionIdx])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case len(versions) == 0 && product != "":
+		return 0, fmt.Errorf("no active build found for %v", product)
+	case len(versions) != 1:
+		return 0, fmt.Errorf("found %v active builds, expected 1", len(versions))
+	}
+
+	return interfaceVersion(versions[0])
+}
+
+// interfaceVersion converts a client version to its interface version, eg 11.1.5.60392 => 110105
+func interfaceVersion(version string) (int, error) {
+	parts := strings.SplitN(version, ".", 4)
+	if len(parts) < 3 {
+		return 0, fmt.Errorf("invalid client version %v", version)
+	}
+
+	iface := 0
+	for _, part := range parts[:3] {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || n > 99 {
+			return 0, fmt.Errorf("invalid client version %v", version)
+		}
+		iface = iface*100 + n
+	}
+
+	return iface, nil
+}
+
+// compatibleInterface reports if an addon built for any of ifaces loads on a client with interface
+// client without being out of date. an interface is compatible if it is from the same expansion and
+// not older than the client's minor patch. unknown versions are assumed compatible
+func compatibleInterface(ifaces []int, client int) bool {
+	if client == 0 || len(ifaces) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(ifaces, func(iface int) bool {
+		return iface/10000 == client/10000 && iface/100 >= client/100
+	})
+}
+
+// validCompat checks compat is a known compatibility policy, an empty policy defaults to warn
+func validCompat(compat string) error {
+	switch compat {
+	case "", CompatWarn, CompatRefuse, CompatIgnore:
+		return nil
+	default:
+		return fmt.Errorf("unknown compat policy %v, expected one of %v, %v, %v", compat, CompatWarn, CompatRefuse, CompatIgnore)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testBuildInfo = "Branch!STRING:0|Active!DEC:1|Build Key!HEX:16|Version!STRING:0|Product!STRING:0\n" +
+	"us|1|abc|11.1.5.60392|wow\n" +
+	"us|1|def|11.1.7.61131|wowt\n" +
+	"us|0|123|11.0.7.58123|wow_classic\n" +
+	"us|1|456|1.15.7.61582|wow_classic_era\n"
+
+func TestParseBuildInfo(t *testing.T) {
+	tests := []struct {
+		product  string
+		expected int
+	}{
+		{"wow", 110105},
+		{"wowt", 110107},
+		{"wow_classic_era", 11507},
+		// inactive builds are ignored
+		{"wow_classic", 0},
+		{"wow_beta", 0},
+		// product is required when multiple builds are active
+		{"", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.product, func(t *testing.T) {
+			iface, err := parseBuildInfo(strings.NewReader(testBuildInfo), tc.product)
+			if tc.expected == 0 {
+				if err == nil {
+					t.Errorf("expected error parsing build info, got %v", iface)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("error parsing build info: %v", err)
+				return
+			}
+			testEq(t, "interface", iface, tc.expected)
+		})
+	}
+}
+
+func TestDetectInterface(t *testing.T) {
+	wowDir := t.TempDir()
+	testWriteFile(t, wowDir+"/.build.info", testBuildInfo)
+	testWriteFile(t, wowDir+"/_classic_era_/Interface/AddOns/.keep", "")
+
+	iface, err := detectInterface(wowDir + "/_classic_era_/Interface/AddOns")
+	if err != nil {
+		t.Fatalf("error detecting interface: %v", err)
+	}
+	testEq(t, "interface", iface, 11507)
+
+	inst := &Installation{addonsDir: wowDir + "/_retail_/Interface/AddOns"}
+	testEq(t, "resolved interface", inst.resolveInterface(), 110105)
+
+	// configured interface takes priority
+	inst = &Installation{Interface: 110200, addonsDir: wowDir + "/_retail_/Interface/AddOns"}
+	testEq(t, "configured interface", inst.resolveInterface(), 110200)
+}
+
+func TestCompatibleInterface(t *testing.T) {
+	tests := []struct {
+		name     string
+		ifaces   []int
+		client   int
+		expected bool
+	}{
+		{"same patch", []int{110105}, 110105, true},
+		{"older hotfix", []int{110100}, 110105, true},
+		{"newer patch", []int{110200}, 110105, true},
+		{"older patch", []int{110007}, 110105, false},
+		{"other expansion", []int{110105}, 11507, false},
+		{"any supported interface", []int{110007, 11507}, 11507, true},
+		{"unknown release interface", nil, 110105, true},
+		{"unknown client interface", []int{110007}, 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			testEq(t, "compatible", compatibleInterface(tc.ifaces, tc.client), tc.expected)
+		})
+	}
+}
@@ -1,34 +1,41 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	var (
-		am        *AddonManager
-		err       error
-		addonsCfg = "addons.json"
-	)
+	ctx, cancel := context.WithCancel(context.Background())
 
-	defer func() {
-		fmt.Println("\npress any key to exit...")
-		devMode := am != nil && am.CacheDir != "" // cacheDir is usually only set during development, use it as a proxy for dev
-		if err != nil && !devMode {               // dont wait in dev mode
-			fmt.Scanf("h")
-		}
+	// stop starting new work on the first interrupt, letting in-flight installs finish or roll back
+	// and the config save. a second interrupt exits immediately
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		fmt.Println(tcYellow("\ninterrupted, finishing in-flight updates (interrupt again to exit now)"))
+		cancel()
 	}()
 
-	am, err = LoadAddonCfg(addonsCfg)
-	if err != nil {
-		fmt.Println(tcRed("error loading addon config from "+addonsCfg), err)
-		return
+	c, err := runCli(ctx, os.Args[1:])
+	code := exitCode(err)
+	if code == 1 {
+		fmt.Println(tcRed("error:"), err)
 	}
-	// fmt.Println(am)
-
-	am.UpdateAddons()
 
-	if err = am.SaveAddonCfg(addonsCfg); err != nil {
-		fmt.Println(tcRed("error saving addon confing to "+addonsCfg), err)
+	// launched without a command (ie double-clicked), keep the console open so errors can be read
+	if len(os.Args) < 2 {
+		fmt.Println("\npress any key to exit...")
+		devMode := c.am != nil && c.am.CacheDir != "" // cacheDir is usually only set during development, use it as a proxy for dev
+		if code != 0 && !devMode {                    // dont wait in dev mode
+			fmt.Scanf("h")
+		}
 	}
+
+	os.Exit(code)
 }
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	githubApiHost = "api.github.com"
+	// warn when fewer github api requests than this remain
+	lowRateLimit = 10
+
+	// timeout for establishing a connection and for an entire request including reading the body
+	connectTimeout = 10 * time.Second
+	requestTimeout = 5 * time.Minute
+	// longest we wait before retrying a request or for the github rate limit to reset
+	maxRetryWait = time.Minute
+)
+
+var (
+	errRateLimited = errors.New("github api rate limit exceeded")
+	// returned by conditional requests when the resource has not changed
+	errNotModified = errors.New("not modified")
+
+	// delay before the first retry, doubled (with jitter) for every following retry
+	retryBaseDelay = 500 * time.Millisecond
+)
+
+func newHttpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+
+	return &http.Client{Transport: transport, Timeout: requestTimeout}
+}
+
+// httpGet requests url with header, reading the response body into a.buf if the status is 200 OK.
+// the body of the returned response is always closed.
+//
+// network errors and transient server errors are retried up to a.retries times with jittered
+// exponential backoff, honoring Retry-After. github api requests are authenticated with
+// githubToken, short github rate limits are waited out and longer ones reported as errRateLimited
+func (a *Addon) httpGet(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for %v: %w", url, err)
+	}
+	maps.Copy(req.Header, header)
+	isGithubApi := githubAuth(req, a.githubToken)
+	a.apiKeyAuth(req)
+
+	rateLimitWaited := false
+	for attempt := 0; ; attempt++ {
+		res, err := a.httpDo(req)
+		canRetry := attempt < a.retries
+
+		var wait time.Duration
+		var reason string
+		// only github api responses report a rate limit
+		limit := ghRateLimit{remaining: -1}
+		if err == nil && isGithubApi {
+			limit = parseRateLimit(res, time.Now())
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil:
+			if !canRetry {
+				return nil, err
+			}
+			wait, reason = retryBackoff(attempt), err.Error()
+		case limit.exceeded:
+			wait = time.Until(limit.reset)
+			if rateLimitWaited || wait > maxRetryWait {
+				return nil, limit.err(a.githubToken != "")
+			}
+			rateLimitWaited, reason = true, "github rate limit reached"
+			// waiting out the rate limit does not count as a retry
+			attempt--
+		case retryableStatus(res.StatusCode) && canRetry:
+			var ok bool
+			if wait, ok = retryAfter(res, time.Now()); !ok {
+				wait = retryBackoff(attempt)
+			}
+			if wait > maxRetryWait {
+				return res, nil
+			}
+			reason = res.Status
+		default:
+			if limit.remaining >= 0 && limit.remaining < lowRateLimit {
+				a.deferLogf("%v %v requests remaining until %v\n", tcYellow("github rate limit low:"), limit.remaining,
+					limit.reset.Local().Format(time.Kitchen))
+			}
+			return res, nil
+		}
+
+		a.deferLogf("%v %v, retrying in %v\n", tcYellow("request failed:"), reason, wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// httpDo makes a single request, reading the body into a.buf if the status is 200 OK
+func (a *Addon) httpDo(req *http.Request) (*http.Response, error) {
+	a.buf.Reset()
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error opening connection to %v: %w", req.URL, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		if _, err := io.Copy(a.buf, res.Body); err != nil {
+			return nil, fmt.Errorf("error reading response from %v: %w", req.URL, err)
+		}
+	}
+
+	return res, nil
+}
+
+// retryableStatus reports if a request failing with status may succeed if retried
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryBackoff returns the jittered delay before retrying after attempt failed, between 50% and
+// 100% of retryBaseDelay*2^attempt
+func retryBackoff(attempt int) time.Duration {
+	delay := min(retryBaseDelay<<attempt, maxRetryWait)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryAfter parses the Retry-After header of res, in either seconds or as an http date
+func retryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	header := res.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(secs)*time.Second, 0), true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// githubAuth adds token to req if it is for the github api, tokens are never sent to other hosts.
+// returns if req is for the github api
+func githubAuth(req *http.Request, token string) bool {
+	if req.URL.Scheme != "https" || req.URL.Host != githubApiHost {
+		return false
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return true
+}
+
+// apiKeyAuth adds the api key of the addon's source to req if it is for the source's api, keys are
+// never sent to other hosts such as download cdns
+func (a *Addon) apiKeyAuth(req *http.Request) {
+	isApi := func(api string) bool { return strings.HasPrefix(req.URL.String(), api+"/") }
+
+	switch {
+	case a.RelType == CfRel && a.curseforgeApiKey != "" && isApi(a.curseforgeApi()):
+		req.Header.Set("x-api-key", a.curseforgeApiKey)
+	case a.RelType == WgRel && a.wagoApiKey != "" && isApi(a.wagoApi()):
+		req.Header.Set("Authorization", "Bearer "+a.wagoApiKey)
+	}
+}
+
+type ghRateLimit struct {
+	// requests left in the current window, -1 if unknown
+	remaining int
+	// when requests can be made again
+	reset time.Time
+	// res was rejected due to rate limiting
+	exceeded bool
+}
+
+// parseRateLimit reads github rate limit headers from res
+//
+// https://docs.github.com/en/rest/using-the-rest-api/rate-limits-for-the-rest-api
+func parseRateLimit(res *http.Response, now time.Time) ghRateLimit {
+	limit := ghRateLimit{remaining: -1, reset: now}
+
+	if remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining")); err == nil {
+		limit.remaining = remaining
+	}
+	if reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		limit.reset = time.Unix(reset, 0)
+	}
+	// secondary rate limits set retry-after instead, which takes priority
+	wait, hasRetryAfter := retryAfter(res, now)
+	if hasRetryAfter {
+		limit.reset = now.Add(wait)
+	}
+
+	rejected := res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusTooManyRequests
+	limit.exceeded = rejected && (limit.remaining == 0 || hasRetryAfter)
+
+	return limit
+}
+
+func (l ghRateLimit) err(authenticated bool) error {
+	hint := ""
+	if !authenticated {
+		hint = ", set GithubToken in the config or GITHUB_TOKEN to raise the limit"
+	}
+
+	return fmt.Errorf("%w: resets at %v (in %v)%v", errRateLimited, l.reset.Local().Format(time.Kitchen),
+		time.Until(l.reset).Round(time.Second), hint)
+}
+
+// httpValidators are the response headers used to make conditional requests for a url
+//
+// https://docs.github.com/en/rest/using-the-rest-api/best-practices-for-using-the-rest-api#use-conditional-requests-if-appropriate
+type httpValidators struct {
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+}
+
+// newHttpValidators reads validators from res, falling back to prev for any missing header.
+// returns nil if there are none
+func newHttpValidators(res *http.Response, prev *httpValidators) *httpValidators {
+	v := &httpValidators{res.Header.Get("ETag"), res.Header.Get("Last-Modified")}
+	if prev != nil && res.StatusCode == http.StatusNotModified {
+		v.ETag = cmp.Or(v.ETag, prev.ETag)
+		v.LastModified = cmp.Or(v.LastModified, prev.LastModified)
+	}
+
+	if *v == (httpValidators{}) {
+		return nil
+	}
+	return v
+}
+
+// setHeaders adds conditional request headers to header, v can be nil
+func (v *httpValidators) setHeaders(header http.Header) {
+	if v == nil {
+		return
+	}
+
+	if v.ETag != "" {
+		header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		header.Set("If-Modified-Since", v.LastModified)
+	}
+}
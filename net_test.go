@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGithubAuth(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		token       string
+		isGithubApi bool
+		auth        string
+	}{
+		{"github api", "https://api.github.com/repos/proj/addon/releases/latest", "token", true, "Bearer token"},
+		{"github api without token", "https://api.github.com/repos/proj/addon/releases/latest", "", true, ""},
+		{"github download", "https://github.com/proj/addon/releases/download/v1/addon.zip", "token", false, ""},
+		{"other host", "https://example.com/api.github.com/addon.zip", "token", false, ""},
+		{"github api over http", "http://api.github.com/repos/proj/addon/releases/latest", "token", false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			if err != nil {
+				t.Fatalf("error creating request: %v", err)
+			}
+
+			testEq(t, "isGithubApi", githubAuth(req, tc.token), tc.isGithubApi)
+			testEq(t, "Authorization", req.Header.Get("Authorization"), tc.auth)
+		})
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	reset := now.Add(30 * time.Minute).Truncate(time.Second)
+	mkRes := func(status int, headers ...string) *http.Response {
+		res := &http.Response{StatusCode: status, Header: http.Header{}}
+		for i := 0; i < len(headers); i += 2 {
+			res.Header.Set(headers[i], headers[i+1])
+		}
+		return res
+	}
+	resetHeader := strconv.FormatInt(reset.Unix(), 10)
+
+	tests := []struct {
+		name     string
+		input    *http.Response
+		expected ghRateLimit
+	}{
+		{
+			name:     "no rate limit headers",
+			input:    mkRes(http.StatusOK),
+			expected: ghRateLimit{remaining: -1, reset: now},
+		}, {
+			name:     "requests remaining",
+			input:    mkRes(http.StatusOK, "X-RateLimit-Remaining", "42", "X-RateLimit-Reset", resetHeader),
+			expected: ghRateLimit{remaining: 42, reset: reset},
+		}, {
+			name:     "primary rate limit exceeded",
+			input:    mkRes(http.StatusForbidden, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", resetHeader),
+			expected: ghRateLimit{remaining: 0, reset: reset, exceeded: true},
+		}, {
+			name:     "secondary rate limit exceeded",
+			input:    mkRes(http.StatusTooManyRequests, "X-RateLimit-Remaining", "12", "Retry-After", "5"),
+			expected: ghRateLimit{remaining: 12, reset: now.Add(5 * time.Second), exceeded: true},
+		}, {
+			name:     "forbidden without rate limit",
+			input:    mkRes(http.StatusForbidden, "X-RateLimit-Remaining", "12", "X-RateLimit-Reset", resetHeader),
+			expected: ghRateLimit{remaining: 12, reset: reset},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			limit := parseRateLimit(tc.input, now)
+
+			testEq(t, "remaining", limit.remaining, tc.expected.remaining)
+			testEqFunc(t, "reset", limit.reset, tc.expected.reset, time.Time.Equal)
+			testEq(t, "exceeded", limit.exceeded, tc.expected.exceeded)
+		})
+	}
+}
+
+func TestAddon_httpGet_retry(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	// closeConn drops the connection without responding
+	closeConn := func(w http.ResponseWriter) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatalf("error hijacking connection: %v", err)
+		}
+		conn.Close()
+	}
+
+	tests := []struct {
+		name string
+		// responses for each request in order, the last one is repeated. 0 closes the connection
+		statuses   []int
+		retryAfter string
+		retries    int
+		status     int
+		requests   int
+	}{
+		{"success", []int{200}, "", 3, 200, 1},
+		{"transient server errors", []int{502, 503, 200}, "", 3, 200, 3},
+		{"connection reset", []int{0, 200}, "", 3, 200, 2},
+		{"honor retry-after", []int{429, 200}, "0", 3, 200, 2},
+		{"retries exhausted", []int{500}, "", 2, 500, 3},
+		{"retries disabled", []int{503, 200}, "", 0, 503, 1},
+		{"client errors are not retried", []int{404, 200}, "", 3, 404, 1},
+		{"retry-after too long", []int{503, 200}, "3600", 3, 503, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[min(requests, len(tc.statuses)-1)]
+				requests++
+
+				switch status {
+				case 0:
+					closeConn(w)
+				case 200:
+					w.Write([]byte("data"))
+				default:
+					if tc.retryAfter != "" {
+						w.Header().Set("Retry-After", tc.retryAfter)
+					}
+					w.WriteHeader(status)
+				}
+			}))
+			defer srv.Close()
+
+			addon := &Addon{Name: "proj/addon"}
+			testSharedState(t, addon, "", t.TempDir())
+			addon.retries = tc.retries
+
+			res, err := addon.httpGet(t.Context(), srv.URL, nil)
+			if err != nil {
+				t.Fatalf("error requesting %v: %v", srv.URL, err)
+			}
+			testEq(t, "status", res.StatusCode, tc.status)
+			testEq(t, "requests", requests, tc.requests)
+			if tc.status == 200 {
+				testEq(t, "body", addon.buf.String(), "data")
+			}
+		})
+	}
+}
+
+func TestAddon_httpGet_rateLimitLog(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	addon := &Addon{Name: "proj/addon"}
+	testSharedState(t, addon, "", t.TempDir())
+
+	// rate limits are only read from the github api, other hosts never warn about them
+	if _, err := addon.httpGet(t.Context(), srv.URL, nil); err != nil {
+		t.Fatalf("error requesting %v: %v", srv.URL, err)
+	}
+	testEq(t, "logs", len(addon.netLogs), 0)
+}
+
+func TestAddon_httpGet_connectionError(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	addon := &Addon{Name: "proj/addon"}
+	testSharedState(t, addon, "", t.TempDir())
+	addon.retries = 2
+
+	if _, err := addon.httpGet(t.Context(), srv.URL, nil); err == nil {
+		t.Errorf("expected error connecting to closed server")
+	}
+}
+
+func TestAddon_httpGet_cancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	addon := &Addon{Name: "proj/addon"}
+	testSharedState(t, addon, "", t.TempDir())
+	addon.retries = 3
+
+	// cancelling should interrupt waiting to retry
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := addon.httpGet(ctx, srv.URL, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request not cancelled while waiting to retry, took %v", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected time.Duration
+		ok       bool
+	}{
+		{"missing", "", 0, false},
+		{"seconds", "120", 2 * time.Minute, true},
+		{"http date", now.Add(time.Minute).UTC().Format(http.TimeFormat), time.Minute, true},
+		{"date in the past", now.Add(-time.Minute).UTC().Format(http.TimeFormat), 0, true},
+		{"invalid", "soon", 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{}}
+			if tc.header != "" {
+				res.Header.Set("Retry-After", tc.header)
+			}
+
+			// http dates have second precision
+			wait, ok := retryAfter(res, now.Truncate(time.Second))
+			testEq(t, "ok", ok, tc.ok)
+			testEq(t, "wait", wait.Round(time.Second), tc.expected)
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = 100 * time.Millisecond
+
+	for attempt := range 12 {
+		delay := min(retryBaseDelay<<attempt, maxRetryWait)
+		for range 20 {
+			if wait := retryBackoff(attempt); wait < delay/2 || wait > delay {
+				t.Errorf("attempt %v backoff out of range: %v not in [%v, %v]", attempt, wait, delay/2, delay)
+			}
+		}
+	}
+}
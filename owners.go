@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// policies for top-level folders installed by more than one addon
+const (
+	ConflictError  = "error" // fail the update of the later addon (default)
+	ConflictFirst  = "first" // the addon that installed the folder first keeps it, others skip it
+	ConflictShared = "shared"
+)
+
+// folderOwners tracks which addons of an installation own each top-level folder in the AddOns dir,
+// built from every ExtractedDirs. shared folders are only removed once no addon owns them. a nil
+// folderOwners does not track ownership, addons always own their folders
+type folderOwners struct {
+	mu     sync.Mutex
+	policy string
+	// lowercased folder => names of the addons owning it
+	owners map[string][]string
+	// held while swapping folders in, so shared folders are never swapped concurrently
+	swapMu sync.Mutex
+}
+
+func newFolderOwners(addons []*Addon, policy string) *folderOwners {
+	fo := &folderOwners{policy: policy, owners: map[string][]string{}}
+	for _, addon := range addons {
+		if addon.AddonUpdateInfo == nil {
+			continue
+		}
+		for _, dir := range addon.ExtractedDirs {
+			fo.add(addon.Name, dir)
+		}
+	}
+
+	return fo
+}
+
+func (fo *folderOwners) add(name, dir string) {
+	key := strings.ToLower(dir)
+	if !slices.Contains(fo.owners[key], name) {
+		fo.owners[key] = append(fo.owners[key], name)
+	}
+}
+
+// others returns the addons other than name owning dir
+func (fo *folderOwners) others(name, dir string) []string {
+	if fo == nil {
+		return nil
+	}
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	return slices.DeleteFunc(slices.Clone(fo.owners[strings.ToLower(dir)]), func(owner string) bool { return owner == name })
+}
+
+// claim takes ownership of dirs for addon name before they are installed, resolving folders owned
+// by other addons with the conflict policy. returns the dirs name may install. claims are recorded
+// immediately so addons updating concurrently see them, call set to finalize or undo the claim
+func (fo *folderOwners) claim(name string, dirs []string) ([]string, error) {
+	if fo == nil {
+		return dirs, nil
+	}
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	claimed := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		owners := fo.owners[strings.ToLower(dir)]
+		others := slices.DeleteFunc(slices.Clone(owners), func(owner string) bool { return owner == name })
+		// folders name already shares are kept, only new conflicts are resolved
+		if len(others) != 0 && !slices.Contains(owners, name) {
+			switch fo.policy {
+			case ConflictFirst:
+				continue
+			case ConflictShared:
+			default:
+				return nil, fmt.Errorf("folder %v is already installed by %v, set FolderConflicts to %v or %v to allow it",
+					dir, strings.Join(others, ", "), ConflictFirst, ConflictShared)
+			}
+		}
+		claimed = append(claimed, dir)
+	}
+
+	for _, dir := range claimed {
+		fo.add(name, dir)
+	}
+
+	return claimed, nil
+}
+
+// set replaces the folders owned by addon name with dirs
+func (fo *folderOwners) set(name string, dirs []string) {
+	if fo == nil {
+		return
+	}
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+
+	for key, owners := range fo.owners {
+		if owners = slices.DeleteFunc(owners, func(owner string) bool { return owner == name }); len(owners) == 0 {
+			delete(fo.owners, key)
+		} else {
+			fo.owners[key] = owners
+		}
+	}
+	for _, dir := range dirs {
+		fo.add(name, dir)
+	}
+}
+
+// lockSwap serializes swapping folders into the AddOns dir, returning the unlock func
+func (fo *folderOwners) lockSwap() func() {
+	if fo == nil {
+		return func() {}
+	}
+	fo.swapMu.Lock()
+
+	return fo.swapMu.Unlock
+}
+
+// validConflictPolicy checks policy is a known folder conflict policy, empty defaults to error
+func validConflictPolicy(policy string) error {
+	switch policy {
+	case "", ConflictError, ConflictFirst, ConflictShared:
+		return nil
+	default:
+		return fmt.Errorf("unknown FolderConflicts policy %v, expected one of %v, %v, %v", policy, ConflictError, ConflictFirst, ConflictShared)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAddon_extractZip_conflicts(t *testing.T) {
+	tests := []struct {
+		policy string
+		// expected folders installed by addonB, nil if the update fails
+		expected []string
+		// expected Lib/Lib.toc after installing addonB, and after addonA drops Lib
+		lib, libDropped string
+	}{
+		{ConflictError, nil, "a", "<missing>"},
+		{ConflictFirst, []string{"B"}, "a", "<missing>"},
+		{ConflictShared, []string{"Lib", "B"}, "b", "b"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.policy, func(t *testing.T) {
+			addonsDir := t.TempDir()
+			testWriteFile(t, addonsDir+"/A/A.toc", "a")
+			testWriteFile(t, addonsDir+"/Lib/Lib.toc", "a")
+
+			am := newAddonManager()
+			addonA, addonB := &Addon{Name: "proj/a"}, &Addon{Name: "proj/b"}
+			if err := am.initializeAddon(addonA, &AddonUpdateInfo{ExtractedDirs: []string{"A", "Lib"}}); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			if err := am.initializeAddon(addonB, nil); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			owners := newFolderOwners([]*Addon{addonA, addonB}, tc.policy)
+
+			testSharedState(t, addonB, t.TempDir(), addonsDir)
+			addonB.owners = owners
+			addonB.buf.Write(testZip(t,
+				testZipEntry{name: "Lib/Lib.toc", data: "b"},
+				testZipEntry{name: "B/B.toc", data: "b"},
+			))
+
+			extractedDirs, err := addonB.extractZip(t.Context())
+			if tc.expected == nil {
+				if err == nil {
+					t.Errorf("expected error extracting conflicting folder")
+				}
+				testEq(t, "B/B.toc", testReadFile(t, addonsDir+"/B/B.toc"), "<missing>")
+				testEq(t, "Lib owners", len(owners.others("", "Lib")), 1)
+			} else if err != nil {
+				t.Fatalf("error extracting zip: %v", err)
+			} else {
+				testEqFunc(t, "extractedDirs", extractedDirs, tc.expected, slices.Equal)
+				addonB.ExtractedDirs = extractedDirs
+			}
+			testEq(t, "Lib/Lib.toc", testReadFile(t, addonsDir+"/Lib/Lib.toc"), tc.lib)
+
+			// addonA stops shipping Lib, it is only removed if addonB does not share it
+			testSharedState(t, addonA, t.TempDir(), addonsDir)
+			addonA.owners = owners
+			addonA.buf.Write(testZip(t, testZipEntry{name: "A/A.toc", data: "a2"}))
+			if _, err := addonA.extractZip(t.Context()); err != nil {
+				t.Fatalf("error extracting zip: %v", err)
+			}
+			testEq(t, "A/A.toc", testReadFile(t, addonsDir+"/A/A.toc"), "a2")
+			testEq(t, "Lib/Lib.toc after drop", testReadFile(t, addonsDir+"/Lib/Lib.toc"), tc.libDropped)
+		})
+	}
+}
+
+func TestFolderOwners_claim(t *testing.T) {
+	addons := []*Addon{
+		{Name: "proj/a", AddonUpdateInfo: &AddonUpdateInfo{ExtractedDirs: []string{"A", "Lib"}}},
+		{Name: "proj/b", AddonUpdateInfo: &AddonUpdateInfo{ExtractedDirs: []string{"B", "lib"}}},
+	}
+	owners := newFolderOwners(addons, ConflictError)
+
+	// already shared folders are not a new conflict
+	dirs, err := owners.claim("proj/a", []string{"A", "Lib"})
+	if err != nil {
+		t.Fatalf("error claiming shared folder: %v", err)
+	}
+	testEqFunc(t, "claimed", dirs, []string{"A", "Lib"}, slices.Equal)
+
+	// claims are visible to other addons before they are finalized
+	if _, err := owners.claim("proj/c", []string{"C", "New"}); err != nil {
+		t.Fatalf("error claiming folders: %v", err)
+	}
+	if _, err := owners.claim("proj/a", []string{"new"}); err == nil {
+		t.Errorf("expected error claiming folder claimed by another addon")
+	}
+
+	// failed updates restore the previous folders
+	owners.set("proj/c", nil)
+	testEqFunc(t, "New owners", owners.others("", "New"), nil, slices.Equal)
+	testEqFunc(t, "Lib owners", owners.others("proj/b", "LIB"), []string{"proj/a"}, slices.Equal)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// previously installed versions are kept inside AddonsDir, numbered per addon:
+// .wau-generations/PROJECT_ADDON/N/ holds the replaced folders and their update info
+const (
+	generationsDir = ".wau-generations"
+	generationInfo = "generation.json"
+)
+
+// generation is a previously installed version of an addon, kept so it can be rolled back to
+type generation struct {
+	// increases with every update, the latest generation has the highest id
+	Id int `json:"-"`
+	// when this version was replaced
+	ReplacedOn time.Time
+	*AddonUpdateInfo
+	// folders kept in the generation, folders shared with other addons are left in place
+	dirs []string
+}
+
+// addonDirName is the name of the per addon staging, backup and generation dirs.
+// PROJECT/ADDON => PROJECT_ADDON
+func addonDirName(name string) string {
+	return strings.ReplaceAll(name, "/", "_")
+}
+
+// generationIds returns the ids of the generations kept for addon name, latest first
+func generationIds(root *os.Root, name string) ([]int, error) {
+	entries, err := fs.ReadDir(root.FS(), generationsDir+"/"+addonDirName(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading generations dir: %w", err)
+	}
+
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		if id, err := strconv.Atoi(entry.Name()); err == nil && id > 0 && entry.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b int) int { return cmp.Compare(b, a) })
+
+	return ids, nil
+}
+
+// readGenerations returns the generations kept for addon name, latest first
+func readGenerations(root *os.Root, name string) ([]*generation, error) {
+	ids, err := generationIds(root, name)
+	if err != nil {
+		return nil, err
+	}
+
+	gens := make([]*generation, 0, len(ids))
+	for _, id := range ids {
+		dir := fmt.Sprintf("%v/%v/%v", generationsDir, addonDirName(name), id)
+		gen := &generation{Id: id}
+		if data, err := root.ReadFile(dir + "/" + generationInfo); err != nil {
+			return nil, fmt.Errorf("error reading generation %v: %w", id, err)
+		} else if err := json.Unmarshal(data, gen); err != nil || gen.AddonUpdateInfo == nil {
+			return nil, fmt.Errorf("error decoding generation %v: %w", id, err)
+		}
+
+		entries, err := fs.ReadDir(root.FS(), dir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading generation %v: %w", id, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				gen.dirs = append(gen.dirs, entry.Name())
+			}
+		}
+		gens = append(gens, gen)
+	}
+
+	return gens, nil
+}
+
+// generations returns the previous versions kept for addon, latest first
+func (inst *Installation) generations(addon *Addon) ([]*generation, error) {
+	root, err := inst.openAddonsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return readGenerations(root, addon.Name)
+}
+
+// keepGeneration turns the dirs moved to backupDir by an update into a new generation, along with
+// the update info of the version they belong to. nothing is kept if generations are disabled
+func (a *Addon) keepGeneration(backupDir string, backedUp []string) error {
+	if a.generations <= 0 || len(a.ExtractedDirs) == 0 || len(backedUp) == 0 {
+		return nil
+	}
+
+	ids, err := generationIds(a.addonsDir, a.Name)
+	if err != nil {
+		return err
+	}
+	id := 1
+	if len(ids) != 0 {
+		id = ids[0] + 1
+	}
+
+	// validators belong to the latest metadata, not to this version
+	info := *a.AddonUpdateInfo
+	info.HttpValidators = nil
+	data, err := json.Marshal(&generation{ReplacedOn: time.Now(), AddonUpdateInfo: &info})
+	if err != nil {
+		return fmt.Errorf("error encoding generation: %w", err)
+	}
+	if err := a.addonsDir.WriteFile(backupDir+"/"+generationInfo, data, 0644); err != nil {
+		return fmt.Errorf("error writing generation info: %w", err)
+	}
+
+	dir := generationsDir + "/" + addonDirName(a.Name)
+	if err := a.addonsDir.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating generations dir: %w", err)
+	}
+	if err := a.addonsDir.Rename(backupDir, fmt.Sprintf("%v/%v", dir, id)); err != nil {
+		return fmt.Errorf("error keeping generation %v: %w", id, err)
+	}
+
+	return nil
+}
+
+// pruneGenerations removes the oldest generations beyond the number kept per addon
+func (a *Addon) pruneGenerations() error {
+	ids, err := generationIds(a.addonsDir, a.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids[min(len(ids), max(a.generations, 0)):] {
+		dir := fmt.Sprintf("%v/%v/%v", generationsDir, addonDirName(a.Name), id)
+		if err := a.addonsDir.RemoveAll(dir); err != nil {
+			return fmt.Errorf("error removing generation %v: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// rollback reinstalls generation id, or the latest generation if id is 0. the installed version
+// is kept as a new generation so the rollback can be undone
+func (a *Addon) rollback(ctx context.Context, id int) *addonUpdateStatus {
+	status := &addonUpdateStatus{addon: a}
+
+	gens, err := readGenerations(a.addonsDir, a.Name)
+	if err != nil {
+		status.err = a.Errorf("error reading previous versions of %v: %w", a.shortName, err)
+		return status
+	}
+	idx := slices.IndexFunc(gens, func(gen *generation) bool { return id == 0 || gen.Id == id })
+	if idx == -1 && id == 0 {
+		status.err = a.Errorf("no previous versions of %v kept", a.shortName)
+		return status
+	} else if idx == -1 {
+		status.err = a.Errorf("generation %v of %v not found", id, a.shortName)
+		return status
+	} else if err := ctx.Err(); err != nil {
+		status.err = err
+		return status
+	}
+	gen := gens[idx]
+
+	// restore folders of the generation that can still be installed, the claim is undone if the
+	// rollback fails
+	claimedDirs, err := a.owners.claim(a.Name, gen.ExtractedDirs)
+	if err != nil {
+		status.err = a.Errorf("unable to roll back %v: %w", a.shortName, err)
+		return status
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			a.owners.set(a.Name, a.ExtractedDirs)
+		}
+	}()
+	restoreDirs := slices.DeleteFunc(slices.Clone(claimedDirs), func(dir string) bool { return !slices.Contains(gen.dirs, dir) })
+	if len(restoreDirs) == 0 {
+		status.err = a.Errorf("generation %v of %v has no folders to restore", gen.Id, a.shortName)
+		return status
+	}
+
+	a.Logf("rolling back        (%v on %v -> %v on %v)\n", tcGreen(a.Version), fmtUpdateInfo(a.RelType, a.UpdatedOn, a.RefSha),
+		tcGreen(gen.Version), fmtUpdateInfo(a.RelType, gen.UpdatedOn, gen.RefSha))
+
+	genDir := fmt.Sprintf("%v/%v/%v", generationsDir, addonDirName(a.Name), gen.Id)
+	unlock := a.owners.lockSwap()
+	defer unlock()
+	if err := a.swapDirs(genDir, backupDir+"/"+addonDirName(a.Name), restoreDirs); err != nil {
+		status.err = a.Errorf("error rolling back %v: %w", a.shortName, err)
+		return status
+	}
+	swapped = true
+	a.owners.set(a.Name, claimedDirs)
+	a.Logf("restored %v\n", tcMagentaDim(fmt.Sprint(restoreDirs)))
+
+	// the rollback is installed, leftover generations only take up space
+	if err := a.addonsDir.RemoveAll(genDir); err != nil {
+		a.Logf("%v %v\n", tcYellow("unable to remove restored generation:"), err)
+	} else if err := a.pruneGenerations(); err != nil {
+		a.Logf("%v %v\n", tcYellow("unable to remove old generations:"), err)
+	}
+
+	a.ExtractedDirs = claimedDirs
+	a.Toc = gen.Toc
+	a.Version = gen.Version
+	a.UpdatedOn = gen.UpdatedOn
+	a.RefSha = gen.RefSha
+	// metadata validators would report the rolled back version as up to date
+	a.HttpValidators = nil
+
+	return status
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAddon_rollback(t *testing.T) {
+	addonsDir := t.TempDir()
+	testWriteFile(t, addonsDir+"/Addon/Addon.toc", "v1")
+	testWriteFile(t, addonsDir+"/Addon/v1.lua", "v1")
+
+	addon := &Addon{Name: "proj/addon"}
+	if err := newAddonManager().initializeAddon(addon, &AddonUpdateInfo{Version: "v1", ExtractedDirs: []string{"Addon"}}); err != nil {
+		t.Fatalf("error initializing addon: %v", err)
+	}
+	testSharedState(t, addon, "", addonsDir)
+	addon.generations = 2
+
+	install := func(version string) {
+		t.Helper()
+		addon.buf.Reset()
+		addon.buf.Write(testZip(t,
+			testZipEntry{name: "Addon/Addon.toc", data: version},
+			testZipEntry{name: "Addon/" + version + ".lua", data: version},
+		))
+		dirs, err := addon.extractZip(t.Context())
+		if err != nil {
+			t.Fatalf("error extracting %v: %v", version, err)
+		}
+		addon.ExtractedDirs, addon.Version = dirs, version
+	}
+	genVersions := func() []string {
+		t.Helper()
+		gens, err := readGenerations(addon.addonsDir, addon.Name)
+		if err != nil {
+			t.Fatalf("error reading generations: %v", err)
+		}
+		versions := []string{}
+		for _, gen := range gens {
+			versions = append(versions, gen.Version)
+		}
+		return versions
+	}
+
+	install("v2")
+	testEqFunc(t, "generations", genVersions(), []string{"v1"}, slices.Equal)
+	testEq(t, "gen 1 Addon.toc", testReadFile(t, addonsDir+"/"+generationsDir+"/proj_addon/1/Addon/Addon.toc"), "v1")
+
+	// the oldest generation is dropped once more than 2 are kept
+	install("v3")
+	install("v4")
+	testEqFunc(t, "generations", genVersions(), []string{"v3", "v2"}, slices.Equal)
+
+	if status := addon.rollback(t.Context(), 0); status.err != nil {
+		t.Fatalf("error rolling back: %v", status.err)
+	}
+	testEq(t, "Version", addon.Version, "v3")
+	testEq(t, "Addon/Addon.toc", testReadFile(t, addonsDir+"/Addon/Addon.toc"), "v3")
+	testEq(t, "Addon/v4.lua", testReadFile(t, addonsDir+"/Addon/v4.lua"), "<missing>")
+	testEqFunc(t, "generations", genVersions(), []string{"v4", "v2"}, slices.Equal)
+
+	// rolling back to a specific generation keeps the newer ones
+	if status := addon.rollback(t.Context(), 2); status.err != nil {
+		t.Fatalf("error rolling back to generation 2: %v", status.err)
+	}
+	testEq(t, "Version", addon.Version, "v2")
+	testEq(t, "Addon/Addon.toc", testReadFile(t, addonsDir+"/Addon/Addon.toc"), "v2")
+	testEqFunc(t, "generations", genVersions(), []string{"v3", "v4"}, slices.Equal)
+	testEqFunc(t, "ExtractedDirs", addon.ExtractedDirs, []string{"Addon"}, slices.Equal)
+
+	if status := addon.rollback(t.Context(), 2); status.err == nil {
+		t.Errorf("expected error rolling back to missing generation")
+	}
+	testEq(t, "Version", addon.Version, "v2")
+
+	// disabling generations removes the ones already kept
+	addon.generations = 0
+	install("v5")
+	testEqFunc(t, "generations", genVersions(), []string{}, slices.Equal)
+	if status := addon.rollback(t.Context(), 0); status.err == nil {
+		t.Errorf("expected error rolling back without generations")
+	}
+}
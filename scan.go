@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// orphanDir is a folder in the AddOns dir that is not managed by any addon
+type orphanDir struct {
+	dir string
+	// nil if the folder has no toc
+	toc *tocInfo
+}
+
+// isInternalDir reports if name is one of the dirs we keep in the AddOns dir, they are never addons
+func isInternalDir(name string) bool {
+	return name == stagingDir || name == backupDir || name == generationsDir
+}
+
+// addonDirs returns every top-level folder in the AddOns dir except internal dirs, sorted
+func (inst *Installation) addonDirs() ([]string, error) {
+	root, err := inst.openAddonsDir()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := root.Open(".")
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		return nil, fmt.Errorf("error reading addons dir: %w", err)
+	}
+
+	dirs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && !isInternalDir(entry.Name()) {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	slices.Sort(dirs)
+
+	return dirs, nil
+}
+
+// orphanDirs returns the folders in the AddOns dir not claimed by the ExtractedDirs of any addon
+func (inst *Installation) orphanDirs() ([]*orphanDir, error) {
+	dirs, err := inst.addonDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := map[string]bool{}
+	for _, addon := range inst.Addons {
+		for _, dir := range addon.ExtractedDirs {
+			claimed[strings.ToLower(dir)] = true
+		}
+	}
+
+	orphans := []*orphanDir{}
+	for _, dir := range dirs {
+		if claimed[strings.ToLower(dir)] || strings.HasPrefix(dir, "Blizzard_") {
+			continue
+		}
+
+		// folders without a toc are listed too, they are most likely leftovers
+		toc, _ := readToc(inst.addonsRoot, dir, inst.Flavor)
+		orphans = append(orphans, &orphanDir{dir: dir, toc: toc})
+	}
+
+	return orphans, nil
+}
+
+// tag returns the X-* toc tag named tag, matched case-insensitively
+func (o *orphanDir) tag(tag string) string {
+	if o.toc == nil {
+		return ""
+	}
+	for name, value := range o.toc.Extra {
+		if strings.EqualFold(name, tag) {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// suggestedRepo guesses the addon providing the folder from a github X-Website tag
+func (o *orphanDir) suggestedRepo() string {
+	return githubRepo(o.tag("X-Website"))
+}
+
+// githubRepo returns PROJECT/ADDON from a github repo url, or "" if rawUrl is not a github repo
+func githubRepo(rawUrl string) string {
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil || !strings.EqualFold(strings.TrimPrefix(u.Host, "www."), "github.com") {
+		return ""
+	}
+
+	// /PROJECT/ADDON/tree/main => PROJECT, ADDON
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return ""
+	}
+
+	return parts[0] + "/" + strings.TrimSuffix(parts[1], ".git")
+}
+
+// adoptDir makes the addon named repo manage orphan, adding the addon if it is not tracked yet. the
+// folder is replaced by the addon's release on the next update
+func (inst *Installation) adoptDir(orphan *orphanDir, repo string) (*Addon, error) {
+	addon, err := inst.findAddon(repo)
+	if errors.Is(err, errAddonNotFound) {
+		addon = &Addon{Name: repo}
+		if err := inst.addAddon(addon); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	addon.ExtractedDirs = append(addon.ExtractedDirs, orphan.dir)
+	if orphan.toc != nil {
+		if addon.Toc == nil {
+			addon.Toc = map[string]*tocInfo{}
+		}
+		addon.Toc[orphan.dir] = orphan.toc
+	}
+
+	return addon, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInstallation_orphanDirs(t *testing.T) {
+	addonsDir := t.TempDir()
+	testWriteFile(t, addonsDir+"/Managed/Managed.toc", "## Title: Managed")
+	testWriteFile(t, addonsDir+"/BigWigs_Core/BigWigs_Core.toc", "## Title: BigWigs [|cffeda55fCore|r]\n"+
+		"## X-Website: https://github.com/BigWigsMods/BigWigs\n")
+	testWriteFile(t, addonsDir+"/BigWigs_Plugins/BigWigs_Plugins.toc", "## Title: BigWigs [Plugins]\n")
+	testWriteFile(t, addonsDir+"/Details/Details.toc", "## Title: Details!\n## X-Curse-Project-ID: 61284\n")
+	testWriteFile(t, addonsDir+"/Leftover/readme.txt", "")
+	// left behind by an interrupted update
+	testWriteFile(t, addonsDir+"/"+stagingDir+"/Managed/Managed.toc", "")
+	testWriteFile(t, addonsDir+"/"+backupDir+"/Managed/Managed.toc", "")
+	testWriteFile(t, addonsDir+"/"+generationsDir+"/proj_managed/1/Managed/Managed.toc", "")
+	testWriteFile(t, addonsDir+"/Blizzard_Test/Blizzard_Test.toc", "")
+
+	inst := &Installation{AddonsDir: addonsDir, Addons: []*Addon{{Name: "proj/managed"}}}
+	if err := inst.initialize("", true); err != nil {
+		t.Fatalf("error initializing installation: %v", err)
+	}
+	inst.Addons[0].ExtractedDirs = []string{"managed"}
+
+	orphans, err := inst.orphanDirs()
+	if err != nil {
+		t.Fatalf("error scanning addons dir: %v", err)
+	}
+
+	dirs := []string{}
+	for _, orphan := range orphans {
+		dirs = append(dirs, orphan.dir)
+	}
+	testEqFunc(t, "orphans", dirs, []string{"BigWigs_Core", "BigWigs_Plugins", "Details", "Leftover"}, slices.Equal)
+	if len(orphans) != 4 {
+		return
+	}
+
+	bwCore, bwPlugins, details, leftover := orphans[0], orphans[1], orphans[2], orphans[3]
+	testEq(t, "BigWigs_Core title", bwCore.toc.plainTitle(bwCore.dir), "BigWigs [Core]")
+	testEq(t, "BigWigs_Core repo", bwCore.suggestedRepo(), "BigWigsMods/BigWigs")
+	testEq(t, "Details curse id", details.tag("X-Curse-Project-ID"), "61284")
+	testEq(t, "Details repo", details.suggestedRepo(), "")
+	testEq(t, "Leftover title", leftover.toc.plainTitle(leftover.dir), "Leftover")
+
+	// adopting multiple folders into the same addon
+	for _, orphan := range []*orphanDir{bwCore, bwPlugins} {
+		if _, err := inst.adoptDir(orphan, "BigWigsMods/BigWigs"); err != nil {
+			t.Fatalf("error adopting %v: %v", orphan.dir, err)
+		}
+	}
+	if testEq(t, "addons", len(inst.Addons), 2) {
+		bw := inst.Addons[1]
+		testEq(t, "adopted name", bw.Name, "BigWigsMods/BigWigs")
+		testEqFunc(t, "adopted dirs", bw.ExtractedDirs, []string{"BigWigs_Core", "BigWigs_Plugins"}, slices.Equal)
+		testEqPtr(t, "adopted toc", bw.Toc["BigWigs_Core"], bwCore.toc)
+		testEqPtr(t, "adopted updateInfo", bw.AddonUpdateInfo, inst.UpdateInfo[bw.Name])
+	}
+
+	if _, err := inst.adoptDir(details, "details"); err == nil {
+		t.Errorf("expected error adopting into a misformatted addon name")
+	}
+
+	orphans, err = inst.orphanDirs()
+	if err != nil {
+		t.Fatalf("error scanning addons dir: %v", err)
+	}
+	testEq(t, "orphans after adopting", len(orphans), 2)
+}
+
+func TestGithubRepo(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://github.com/BigWigsMods/BigWigs", "BigWigsMods/BigWigs"},
+		{"https://www.github.com/kesava-wow/kuinameplates2/tree/master/", "kesava-wow/kuinameplates2"},
+		{"github.com/WeakAuras/WeakAuras2.git", "WeakAuras/WeakAuras2"},
+		{"https://github.com/BigWigsMods", ""},
+		{"https://www.curseforge.com/wow/addons/details", ""},
+		{"", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.url, func(t *testing.T) {
+			testEq(t, "repo", githubRepo(tc.url), tc.expected)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tocInfo is the metadata parsed from the ## tags of an addon folder's .toc file
+type tocInfo struct {
+	// toc file the metadata was read from, may be a flavor specific toc
+	File string
+	// interface versions the addon supports, tocs can list one per flavor
+	Interface []int  `json:",omitempty"`
+	Title     string `json:",omitempty"`
+	Version   string `json:",omitempty"`
+	// Dependencies and RequiredDeps
+	Dependencies   []string `json:",omitempty"`
+	OptionalDeps   []string `json:",omitempty"`
+	SavedVariables []string `json:",omitempty"`
+	// X-* tags, eg X-Website or X-Curse-Project-ID
+	Extra map[string]string `json:",omitempty"`
+}
+
+// ui escape sequences used to color titles: |cAARRGGBB, |r, |T texture |t and |A atlas |a
+var tocEscapePattern = regexp.MustCompile(`\|c[0-9a-fA-F]{8}|\|r|\|T[^|]*\|t|\|A[^|]*\|a`)
+
+// parseToc reads the ## tags of a toc file. unknown and malformed tags are ignored
+func parseToc(rd io.Reader) (*tocInfo, error) {
+	toc := &tocInfo{}
+	scanner := bufio.NewScanner(rd)
+
+	for first := true; scanner.Scan(); first = false {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		// ## Tag: value
+		line, ok := strings.CutPrefix(strings.TrimSpace(line), "##")
+		if !ok {
+			continue
+		}
+		tag, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		tag, value = strings.TrimSpace(tag), strings.TrimSpace(value)
+
+		switch strings.ToLower(tag) {
+		case "interface":
+			for _, v := range splitTocList(value) {
+				if iface, err := strconv.Atoi(v); err == nil {
+					toc.Interface = append(toc.Interface, iface)
+				}
+			}
+		case "title":
+			toc.Title = value
+		case "version":
+			toc.Version = value
+		case "dependencies", "requireddeps":
+			toc.Dependencies = append(toc.Dependencies, splitTocList(value)...)
+		case "optionaldeps":
+			toc.OptionalDeps = append(toc.OptionalDeps, splitTocList(value)...)
+		case "savedvariables":
+			toc.SavedVariables = append(toc.SavedVariables, splitTocList(value)...)
+		default:
+			if len(tag) > 2 && strings.EqualFold(tag[:2], "x-") {
+				if toc.Extra == nil {
+					toc.Extra = map[string]string{}
+				}
+				toc.Extra[tag] = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return toc, nil
+}
+
+// splitTocList splits a comma separated tag value, dropping empty entries
+func splitTocList(value string) []string {
+	list := []string{}
+	for v := range strings.SplitSeq(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// plainTitle is Title without ui escape sequences, falls back to dir if the toc has no title
+func (t *tocInfo) plainTitle(dir string) string {
+	if t == nil {
+		return dir
+	}
+	return cmp.Or(strings.TrimSpace(tocEscapePattern.ReplaceAllString(t.Title, "")), dir)
+}
+
+// findTocFile returns the toc file the client would load for dir, preferring flavor specific tocs
+// (dir/DIR_Mainline.toc) over dir/DIR.toc. toc names are matched case-insensitively
+func findTocFile(root *os.Root, dir, flavor string) (string, error) {
+	dirFile, err := root.Open(dir)
+	if err != nil {
+		return "", err
+	}
+	defer dirFile.Close()
+
+	entries, err := dirFile.ReadDir(-1)
+	if err != nil {
+		return "", err
+	}
+
+	names := []string{}
+	for _, suffix := range gameFlavors[cmp.Or(flavor, FlavorMainline)].tocSuffixes {
+		names = append(names, dir+"_"+suffix+".toc", dir+"-"+suffix+".toc")
+	}
+	names = append(names, dir+".toc")
+
+	for _, name := range names {
+		idx := slices.IndexFunc(entries, func(e fs.DirEntry) bool {
+			return !e.IsDir() && strings.EqualFold(e.Name(), name)
+		})
+		if idx != -1 {
+			return entries[idx].Name(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no toc found in %v: %w", dir, fs.ErrNotExist)
+}
+
+// readToc parses the toc the client would load for dir
+func readToc(root *os.Root, dir, flavor string) (*tocInfo, error) {
+	name, err := findTocFile(root, dir, flavor)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := root.Open(dir + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	toc, err := parseToc(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %w", name, err)
+	}
+	toc.File = name
+
+	return toc, nil
+}
+
+// readTocs parses the tocs of dirs, keyed by dir. dirs without a toc are skipped, other errors are
+// returned along with the tocs that could be read
+func readTocs(root *os.Root, dirs []string, flavor string) (map[string]*tocInfo, error) {
+	tocs := make(map[string]*tocInfo, len(dirs))
+	errs := []error{}
+
+	for _, dir := range dirs {
+		toc, err := readToc(root, dir, flavor)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tocs[dir] = toc
+	}
+
+	return tocs, errors.Join(errs...)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseToc(t *testing.T) {
+	data := "\ufeff## Interface: 110105, 50500\n" +
+		"## Title: |cff33ff99Big|rWigs [|cffeda55fCore|r]\n" +
+		"## Version: v390.1\n" +
+		"## Notes: ignored\n" +
+		"## Dependencies: BigWigs_Core, BigWigs_Plugins\n" +
+		"## RequiredDeps: LibStub\n" +
+		"## OptionalDeps: Ace3,  , LibSharedMedia-3.0\n" +
+		"## SavedVariables: BigWigsDB\n" +
+		"## X-Website: https://github.com/BigWigsMods/BigWigs\n" +
+		"## x-curse-project-id: 2382\n" +
+		"# ## Title: commented out\n" +
+		"##Malformed\n" +
+		"\n" +
+		"Core.lua\n" +
+		"## Version: v390.2\n"
+
+	toc, err := parseToc(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("error parsing toc: %v", err)
+	}
+
+	testEqFunc(t, "Interface", toc.Interface, []int{110105, 50500}, slices.Equal)
+	testEq(t, "Title", toc.Title, "|cff33ff99Big|rWigs [|cffeda55fCore|r]")
+	testEq(t, "plainTitle", toc.plainTitle("BigWigs"), "BigWigs [Core]")
+	testEq(t, "Version", toc.Version, "v390.2")
+	testEqFunc(t, "Dependencies", toc.Dependencies, []string{"BigWigs_Core", "BigWigs_Plugins", "LibStub"}, slices.Equal)
+	testEqFunc(t, "OptionalDeps", toc.OptionalDeps, []string{"Ace3", "LibSharedMedia-3.0"}, slices.Equal)
+	testEqFunc(t, "SavedVariables", toc.SavedVariables, []string{"BigWigsDB"}, slices.Equal)
+	testEq(t, "Extra length", len(toc.Extra), 2)
+	testEq(t, "X-Website", toc.Extra["X-Website"], "https://github.com/BigWigsMods/BigWigs")
+	testEq(t, "x-curse-project-id", toc.Extra["x-curse-project-id"], "2382")
+}
+
+func TestFindTocFile(t *testing.T) {
+	addonsDir := t.TempDir()
+	testWriteFile(t, addonsDir+"/Addon/Addon.toc", "## Title: Addon")
+	testWriteFile(t, addonsDir+"/Addon/addon_mainline.toc", "## Title: Addon Mainline")
+	testWriteFile(t, addonsDir+"/Addon/Addon_Vanilla.toc", "## Title: Addon Vanilla")
+	testWriteFile(t, addonsDir+"/Addon/Addon_Classic.toc", "## Title: Addon Classic")
+	testWriteFile(t, addonsDir+"/Addon/Addon-Cata.toc", "## Title: Addon Cata")
+	testWriteFile(t, addonsDir+"/NoToc/NoToc.lua", "")
+
+	root, err := os.OpenRoot(addonsDir)
+	if err != nil {
+		t.Fatalf("error opening addons dir: %v", err)
+	}
+	defer root.Close()
+
+	tests := []struct {
+		flavor   string
+		expected string
+	}{
+		{"", "addon_mainline.toc"},
+		{FlavorMainline, "addon_mainline.toc"},
+		{FlavorClassic, "Addon_Vanilla.toc"},
+		{FlavorBcc, "Addon_Classic.toc"},
+		{FlavorCata, "Addon-Cata.toc"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.flavor, func(t *testing.T) {
+			name, err := findTocFile(root, "Addon", tc.flavor)
+			if err != nil {
+				t.Errorf("error finding toc: %v", err)
+				return
+			}
+			testEq(t, "toc file", name, tc.expected)
+		})
+	}
+
+	tocs, err := readTocs(root, []string{"Addon", "NoToc"}, FlavorClassic)
+	if err != nil {
+		t.Fatalf("error reading tocs: %v", err)
+	}
+	if testEq(t, "tocs", len(tocs), 1) {
+		testEq(t, "Addon title", tocs["Addon"].Title, "Addon Vanilla")
+		testEq(t, "Addon file", tocs["Addon"].File, "Addon_Vanilla.toc")
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,10 +11,17 @@ import (
 	"sync"
 )
 
-func fetchJson[T any](a *Addon, url string, fileNm string) (*T, error) {
+// fetchJson downloads and decodes json from url, sending a conditional request if url was fetched
+// before. returns errNotModified if url has not changed since AddonUpdateInfo was last saved
+func fetchJson[T any](ctx context.Context, a *Addon, url string, fileNm string) (*T, error) {
+	return decodeJson[T](ctx, a, url, fileNm, true)
+}
+
+// decodeJson downloads and decodes json from url, see cacheDownload for conditional requests
+func decodeJson[T any](ctx context.Context, a *Addon, url string, fileNm string, conditional bool) (*T, error) {
 	var t *T
 
-	if err := a.cacheDownload(url, fileNm); err != nil {
+	if err := a.cacheDownload(ctx, url, fileNm, conditional); err != nil {
 		return nil, fmt.Errorf("error downloading: %w", err)
 	}
 	if err := json.Unmarshal(a.buf.Bytes(), &t); err != nil {
@@ -22,23 +31,30 @@ func fetchJson[T any](a *Addon, url string, fileNm string) (*T, error) {
 	return t, nil
 }
 
-func (a *Addon) cacheDownload(url string, fileNm string) (err error) {
+// cacheDownload downloads url to a.buf on a net worker. conditional requests send the validators
+// saved in AddonUpdateInfo.HttpValidators and record the response validators in a.validators
+func (a *Addon) cacheDownload(ctx context.Context, url string, fileNm string, conditional bool) (err error) {
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	a.netTasks <- func() {
 		defer wg.Done()
-		err = a.cacheDownloadTask(url, fileNm)
+		err = a.cacheDownloadTask(ctx, url, fileNm, conditional)
 	}
 	wg.Wait()
 
+	// logged once the net worker is free again
+	for _, msg := range a.netLogs {
+		a.logs <- msg
+	}
+	a.netLogs = nil
+
 	return err
 }
 
-func (a *Addon) cacheDownloadTask(url string, fileNm string) (err error) {
+func (a *Addon) cacheDownloadTask(ctx context.Context, url string, fileNm string, conditional bool) error {
 	// cacheFile exists on disk => read from disk, write to buf
 	// cacheFile missing on disk => read from net, write to buf (& disk if cacheFile provided)
 	a.buf.Reset()
-	wr := (io.Writer)(a.buf)
 
 	if a.cacheDir != nil {
 		// optimistically try reading from cache
@@ -49,39 +65,106 @@ func (a *Addon) cacheDownloadTask(url string, fileNm string) (err error) {
 			}
 			return nil
 		}
+	}
 
-		// cache file not found, create it and tee writes to a.buf & cache
-		file, err := a.cacheDir.Create(fileNm)
-		if err != nil {
-			return fmt.Errorf("error creating cache file %v: %w", file, err)
-		}
-		defer file.Close()
-		bufW := bufio.NewWriter(file)
-		defer func() {
-			// flush cache and report any error (don't overwrite err if it is already set)
-			if err2 := bufW.Flush(); err == nil && err2 != nil {
-				err = fmt.Errorf("error flushing cache file %v: %w", file, err2)
-			}
-		}()
-
-		wr = io.MultiWriter(a.buf, bufW)
+	header := http.Header{}
+	prevValidators := a.HttpValidators[url]
+	if a.Pin != a.PinnedTo {
+		// pinned and unpinned tags share a url, validators saved under another pin would hide the
+		// newly pinned version behind a 304
+		prevValidators = nil
+	}
+	if conditional {
+		prevValidators.setHeaders(header)
 	}
 
-	res, err := http.Get(url)
+	res, err := a.httpGet(ctx, url, header)
 	if err != nil {
-		return fmt.Errorf("error opening connection to %v: %w", url, err)
+		return err
 	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
+
+	if v := newHttpValidators(res, prevValidators); conditional && v != nil {
+		a.validators[url] = v
+	}
+	if conditional && res.StatusCode == http.StatusNotModified {
+		return errNotModified
+	} else if res.StatusCode != http.StatusOK {
 		return fmt.Errorf("error fetching %v: %v", url, res.Status)
 	}
 
-	// copy data to buf & cache
-	if _, err := io.Copy(wr, res.Body); err != nil {
-		return fmt.Errorf("error copying data: %w", err)
+	// cache file not found, save response to cache
+	if a.cacheDir != nil {
+		if err := a.cacheDir.WriteFile(fileNm, a.buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing cache file %v: %w", fileNm, err)
+		}
 	}
 
-	return
+	return nil
+}
+
+// downloadCache shares downloaded archives between installations in a single run, so an addon
+// tracked by several installations is only downloaded once. archives are dropped once every
+// installation tracking the addon is done with it. a nil downloadCache caches nothing
+type downloadCache struct {
+	mu sync.Mutex
+	// number of installations yet to finish each addon
+	pending map[string]int
+	// addon name -> download url -> archive
+	archives map[string]map[string][]byte
+}
+
+func newDownloadCache(addons []*Addon) *downloadCache {
+	dc := &downloadCache{
+		pending:  map[string]int{},
+		archives: map[string]map[string][]byte{},
+	}
+	for _, addon := range addons {
+		dc.pending[addon.Name]++
+	}
+
+	return dc
+}
+
+// get returns the archive downloaded from url for addon name, or nil if it has not been downloaded
+func (dc *downloadCache) get(name, url string) []byte {
+	if dc == nil {
+		return nil
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	return dc.archives[name][url]
+}
+
+// put saves a copy of data if another installation has yet to update addon name
+func (dc *downloadCache) put(name, url string, data []byte) {
+	if dc == nil {
+		return
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if dc.pending[name] <= 1 {
+		return
+	}
+	if dc.archives[name] == nil {
+		dc.archives[name] = map[string][]byte{}
+	}
+	dc.archives[name][url] = bytes.Clone(data)
+}
+
+// done marks addon name as finished for one installation, dropping its archives after the last one
+func (dc *downloadCache) done(name string) {
+	if dc == nil {
+		return
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if dc.pending[name]--; dc.pending[name] <= 0 {
+		delete(dc.pending, name)
+		delete(dc.archives, name)
+	}
 }
 
 // terminal colors & styles
@@ -103,6 +186,10 @@ func tcCyan(s string) string {
 	return "\033[1;36m" + s + tcReset
 }
 
+func tcYellow(s string) string {
+	return "\033[33m" + s + tcReset
+}
+
 func tcRed(s string) string {
 	return "\033[1;31m" + s + tcReset
 }
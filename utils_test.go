@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchJson_conditional(t *testing.T) {
+	const etag, lastModified = `"v1"`, "Sat, 01 Jun 2024 00:00:00 GMT"
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"tag_name": "v1"}`))
+	}))
+	defer srv.Close()
+	url := srv.URL + "/releases/latest"
+
+	addon := &Addon{Name: "proj/addon", AddonUpdateInfo: &AddonUpdateInfo{}}
+	testSharedState(t, addon, "", t.TempDir())
+
+	// first request is unconditional
+	rel, err := fetchJson[ghTaggedRel](t.Context(), addon, url, "addon-rel.json")
+	if err != nil {
+		t.Fatalf("error fetching json: %v", err)
+	}
+	testEq(t, "TagName", rel.TagName, "v1")
+	if v := addon.validators[url]; testEq(t, "has validators", v != nil, true) {
+		testEq(t, "ETag", v.ETag, etag)
+		testEq(t, "LastModified", v.LastModified, lastModified)
+	}
+
+	// validators are only sent once saved to AddonUpdateInfo
+	if _, err = fetchJson[ghTaggedRel](t.Context(), addon, url, "addon-rel.json"); err != nil {
+		t.Fatalf("error fetching json: %v", err)
+	}
+
+	addon.HttpValidators = addon.validators
+	_, err = fetchJson[ghTaggedRel](t.Context(), addon, url, "addon-rel.json")
+	testEq(t, "errNotModified", errors.Is(err, errNotModified), true)
+	testEq(t, "requests", requests, 3)
+}
+
+func TestDownloadCache_sharedArchive(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("archive"))
+	}))
+	defer srv.Close()
+	asset := &downloadAsset{Name: "addon-v1.zip", DownloadUrl: srv.URL + "/addon-v1.zip"}
+
+	retail := &Addon{Name: "proj/addon", AddonUpdateInfo: &AddonUpdateInfo{}}
+	classic := &Addon{Name: "proj/addon", AddonUpdateInfo: &AddonUpdateInfo{}}
+	downloads := newDownloadCache([]*Addon{retail, classic})
+	testSharedState(t, retail, "", t.TempDir())
+	testSharedState(t, classic, "", t.TempDir())
+	retail.downloads, classic.downloads = downloads, downloads
+
+	for _, addon := range []*Addon{retail, classic} {
+		if err := addon.downloadZip(t.Context(), asset); err != nil {
+			t.Fatalf("error downloading zip: %v", err)
+		}
+		testEq(t, "archive", addon.buf.String(), "archive")
+		downloads.done(addon.Name)
+	}
+
+	testEq(t, "requests", requests, 1)
+	// archives are dropped once every installation is done
+	testEq(t, "cached archives", len(downloads.archives), 0)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const wagoApiUrl = "https://addons.wago.io/api/external"
+
+type wagoAddon struct {
+	Slug string
+	// latest release of each channel, channels without releases are omitted
+	RecentRelease map[string]*wagoRelease `json:"recent_release"`
+}
+
+type wagoRelease struct {
+	Id        string
+	Label     string
+	Link      string
+	CreatedAt time.Time `json:"created_at"`
+	// supported client versions, from supported_{game version}_patches
+	patches map[string][]string
+}
+
+func (r *wagoRelease) UnmarshalJSON(data []byte) error {
+	type release wagoRelease
+	if err := json.Unmarshal(data, (*release)(r)); err != nil {
+		return err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	r.patches = map[string][]string{}
+	for key, raw := range fields {
+		gameVersion, isPatches := strings.CutPrefix(key, "supported_")
+		gameVersion, hasSuffix := strings.CutSuffix(gameVersion, "_patches")
+		if !isPatches || !hasSuffix {
+			continue
+		}
+		patches := []string{}
+		if err := json.Unmarshal(raw, &patches); err == nil {
+			r.patches[gameVersion] = patches
+		}
+	}
+
+	return nil
+}
+
+// wagoApi returns the api base url for wago, ApiUrl or addons.wago.io
+func (a *Addon) wagoApi() string {
+	if a.ApiUrl == "" {
+		return wagoApiUrl
+	}
+	return strings.TrimSuffix(a.ApiUrl, "/")
+}
+
+func (a *Addon) getWagoRelease(ctx context.Context) (*downloadAsset, error) {
+	const AddonEndpoint = "%v/addons/%v?game_version=%v"
+
+	if a.wagoApiKey == "" {
+		return nil, fmt.Errorf("wago api key required, set WagoApiKey or $WAGO_API_KEY")
+	}
+
+	gameVersion := gameFlavors[cmp.Or(a.flavor, FlavorMainline)].wagoGameVersion
+	endpoint := fmt.Sprintf(AddonEndpoint, a.wagoApi(), url.PathEscape(a.projectId()), gameVersion)
+	cacheFilename := fmt.Sprintf("%v-wago.json", a.shortName)
+	wago, err := fetchJson[wagoAddon](ctx, a, endpoint, cacheFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching update info: %w", err)
+	}
+
+	// newest release of the channel or a more stable channel
+	stability := channelStability[a.Channel]
+	var latest *wagoRelease
+	for channel, rel := range wago.RecentRelease {
+		if s, ok := channelStability[channel]; !ok || s > stability || rel == nil || rel.Link == "" {
+			continue
+		}
+		if latest == nil || rel.CreatedAt.After(latest.CreatedAt) {
+			latest = rel
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no %v releases found for %v", cmp.Or(a.Channel, ChannelStable), a.projectId())
+	}
+
+	ifaces := []int{}
+	for _, patch := range latest.patches[gameVersion] {
+		if iface, err := interfaceVersion(patch); err == nil {
+			ifaces = append(ifaces, iface)
+		}
+	}
+
+	asset := &downloadAsset{
+		Name:        fmt.Sprintf("%v-%v.zip", a.shortName, latest.Label),
+		DownloadUrl: latest.Link,
+		ContentType: "application/zip",
+		UpdatedAt:   latest.CreatedAt,
+		Version:     latest.Label,
+		RelType:     WgRel,
+		Interface:   ifaces,
+	}
+
+	return asset, nil
+}
+
+// wago addon pages, eg https://addons.wago.io/addons/details
+var wagoUrlPattern = regexp.MustCompile(`^(?:https?://)?addons\.wago\.io/addons/([^/?#]+)`)
+
+// parseWagoSlug accepts a wago project slug, id or addon page url, returning the slug or id
+func parseWagoSlug(arg string) (string, error) {
+	if m := wagoUrlPattern.FindStringSubmatch(arg); m != nil {
+		return m[1], nil
+	} else if arg == "" || strings.ContainsAny(arg, "/:?#") {
+		return "", fmt.Errorf("%v is not a wago project slug or url", arg)
+	}
+
+	return arg, nil
+}
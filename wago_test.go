@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// testWagoApi stands in for the wago api under /api, serving project details and their archives
+// under /cdn. requests to the api without the api key are rejected
+func testWagoApi(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	const releaseJson = `"%v": {"id": "%v", "label": "%v", "created_at": "%v",
+		"link": "http://%v/cdn/%[3]v.zip", "supported_%[6]v_patches": ["%[7]v"]}`
+	addonZip := testZip(t, testZipEntry{name: "Addon/Addon.toc", data: "## Interface: 110105"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/addons/details", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch gv := r.URL.Query().Get("game_version"); gv {
+		case "retail":
+			fmt.Fprintf(w, `{"slug": "details", "recent_release": {%v, %v, %v}}`,
+				fmt.Sprintf(releaseJson, "stable", "a1", "v1.0", "2024-05-01T00:00:00Z", r.Host, gv, "11.1.5"),
+				fmt.Sprintf(releaseJson, "beta", "a2", "v1.1-beta", "2024-06-01T00:00:00Z", r.Host, gv, "11.1.5"),
+				fmt.Sprintf(releaseJson, "alpha", "a3", "v1.1-alpha", "2024-05-15T00:00:00Z", r.Host, gv, "11.1.7"))
+		case "classic":
+			fmt.Fprintf(w, `{"slug": "details", "recent_release": {%v}}`,
+				fmt.Sprintf(releaseJson, "stable", "c1", "v1.0-classic", "2024-05-01T00:00:00Z", r.Host, gv, "1.15.7"))
+		default:
+			fmt.Fprint(w, `{"slug": "details", "recent_release": {}}`)
+		}
+	})
+	mux.HandleFunc("/cdn/", func(w http.ResponseWriter, r *http.Request) {
+		// the api key is only sent to the api
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("api key sent to %v", r.URL)
+		}
+		w.Write(addonZip)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAddon_getWagoRelease(t *testing.T) {
+	srv := testWagoApi(t)
+
+	tests := []struct {
+		name    string
+		flavor  string
+		channel string
+		label   string
+		ifaces  []int
+	}{
+		{"stable", "", "", "v1.0", []int{110105}},
+		{"stable channel", "", ChannelStable, "v1.0", []int{110105}},
+		{"beta", "", ChannelBeta, "v1.1-beta", []int{110105}},
+		// the beta release is newer than the alpha release
+		{"alpha", "", ChannelAlpha, "v1.1-beta", []int{110105}},
+		{"classic", FlavorClassic, "", "v1.0-classic", []int{11507}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := &Installation{Flavor: tc.flavor}
+			addon := &Addon{Name: "wago/details", RelType: WgRel, Channel: tc.channel, ApiUrl: srv.URL + "/api"}
+			if err := inst.initializeAddon(addon, nil); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			testSharedState(t, addon, "", t.TempDir())
+			addon.wagoApiKey = "key"
+
+			asset, err := addon.checkUpdate(t.Context())
+			if err != nil {
+				t.Fatalf("error finding wago release: %v", err)
+			}
+			testEq(t, "Version", asset.Version, tc.label)
+			testEq(t, "DownloadUrl", asset.DownloadUrl, srv.URL+"/cdn/"+tc.label+".zip")
+			testEqFunc(t, "Interface", asset.Interface, tc.ifaces, slices.Equal)
+		})
+	}
+}
+
+func TestAddon_getWagoRelease_fail(t *testing.T) {
+	srv := testWagoApi(t)
+
+	tests := []struct {
+		name   string
+		flavor string
+		apiKey string
+	}{
+		{"no api key", "", ""},
+		{"wrong api key", "", "wrong"},
+		{"no releases", FlavorCata, "key"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			inst := &Installation{Flavor: tc.flavor}
+			addon := &Addon{Name: "wago/details", RelType: WgRel, ApiUrl: srv.URL + "/api"}
+			if err := inst.initializeAddon(addon, nil); err != nil {
+				t.Fatalf("error initializing addon: %v", err)
+			}
+			testSharedState(t, addon, "", t.TempDir())
+			addon.wagoApiKey = tc.apiKey
+
+			if asset, err := addon.checkUpdate(t.Context()); err == nil {
+				t.Errorf("expected error finding wago release, got %v", asset.Name)
+			}
+		})
+	}
+}
+
+func TestAddon_update_wago(t *testing.T) {
+	srv := testWagoApi(t)
+	addonsDir := t.TempDir()
+
+	addon := &Addon{Name: "wago/details", RelType: WgRel, ApiUrl: srv.URL + "/api"}
+	if err := newAddonManager().initializeAddon(addon, nil); err != nil {
+		t.Fatalf("error initializing addon: %v", err)
+	}
+	testSharedState(t, addon, "", addonsDir)
+	addon.wagoApiKey = "key"
+
+	if status := addon.update(t.Context()); status.err != nil {
+		t.Fatalf("error updating addon: %v", status.err)
+	}
+	testEq(t, "Version", addon.Version, "v1.0")
+	testEqFunc(t, "ExtractedDirs", addon.ExtractedDirs, []string{"Addon"}, slices.Equal)
+	testEq(t, "Addon/Addon.toc", testReadFile(t, addonsDir+"/Addon/Addon.toc"), "## Interface: 110105")
+
+	if status := addon.update(t.Context()); status.err != nil || status.hasUpdate {
+		t.Errorf("expected no update for installed release, got %v (err %v)", status.hasUpdate, status.err)
+	}
+}
+
+func TestParseWagoSlug(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"details", "details"},
+		{"https://addons.wago.io/addons/details", "details"},
+		{"addons.wago.io/addons/details/versions?stability=beta", "details"},
+		{"https://wago.io/details", ""},
+		{"", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			slug, err := parseWagoSlug(tc.input)
+			if tc.expected == "" {
+				if err == nil {
+					t.Errorf("expected error parsing %v, got %v", tc.input, slug)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("error parsing wago slug: %v", err)
+				return
+			}
+			testEq(t, "slug", slug, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const wowinterfaceApiUrl = "https://api.mmoui.com/v3/game/WOW"
+
+type wiFileDetails struct {
+	UID       string
+	UIName    string
+	UIVersion string
+	// upload time in unix milliseconds
+	UIDate          int64
+	UIFileName      string
+	UIDownload      string
+	UICompatibility []struct {
+		Version string
+	}
+}
+
+// wowinterfaceApi returns the api base url for wowinterface, ApiUrl or api.mmoui.com
+func (a *Addon) wowinterfaceApi() string {
+	if a.ApiUrl == "" {
+		return wowinterfaceApiUrl
+	}
+	return strings.TrimSuffix(a.ApiUrl, "/")
+}
+
+func (a *Addon) getWowinterfaceFile(ctx context.Context) (*downloadAsset, error) {
+	const FileEndpoint = "%v/filedetails/%v.json"
+
+	endpoint := fmt.Sprintf(FileEndpoint, a.wowinterfaceApi(), url.PathEscape(a.projectId()))
+	cacheFilename := fmt.Sprintf("%v-wi.json", a.shortName)
+	files, err := fetchJson[[]*wiFileDetails](ctx, a, endpoint, cacheFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching update info: %w", err)
+	} else if len(*files) == 0 || (*files)[0].UIDownload == "" {
+		return nil, fmt.Errorf("no download found for file %v", a.projectId())
+	}
+	file := (*files)[0]
+
+	ifaces := []int{}
+	for _, compat := range file.UICompatibility {
+		if iface, err := interfaceVersion(compat.Version); err == nil {
+			ifaces = append(ifaces, iface)
+		}
+	}
+
+	asset := &downloadAsset{
+		Name:        file.UIFileName,
+		DownloadUrl: file.UIDownload,
+		ContentType: "application/zip",
+		UpdatedAt:   time.UnixMilli(file.UIDate).UTC(),
+		Version:     file.UIVersion,
+		RelType:     WiRel,
+		Interface:   ifaces,
+	}
+
+	return asset, nil
+}
+
+// wowinterface addon pages, eg https://www.wowinterface.com/downloads/info5108-Clique.html
+var wowinterfaceUrlPattern = regexp.MustCompile(`^(?:https?://)?(?:www\.)?wowinterface\.com/downloads/(?:info|download)(\d+)`)
+
+// parseWowinterfaceId accepts a wowinterface file id or addon page url, returning the file id
+func parseWowinterfaceId(arg string) (string, error) {
+	if m := wowinterfaceUrlPattern.FindStringSubmatch(arg); m != nil {
+		return m[1], nil
+	} else if _, err := strconv.Atoi(arg); err != nil {
+		return "", fmt.Errorf("%v is not a wowinterface file id or url", arg)
+	}
+
+	return arg, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAddon_update_wowinterface(t *testing.T) {
+	const detailsJson = `[{"UID": "5108", "UIName": "Addon", "UIVersion": "%v", "UIDate": %v,
+		"UIFileName": "Addon-%[1]v.zip", "UIDownload": "http://%[3]v/downloads/getfile.php?id=5108",
+		"UICompatibility": [{"version": "11.1.5", "name": "The War Within"}]}]`
+	version, uploaded := "1.0", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/filedetails/5108.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, detailsJson, version, uploaded.UnixMilli(), r.Host)
+	})
+	mux.HandleFunc("/downloads/getfile.php", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testZip(t, testZipEntry{name: "Addon/Addon.toc", data: version}))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	addonsDir := t.TempDir()
+	addon := &Addon{Name: "wowinterface/5108", RelType: WiRel, ApiUrl: srv.URL + "/api"}
+	if err := newAddonManager().initializeAddon(addon, nil); err != nil {
+		t.Fatalf("error initializing addon: %v", err)
+	}
+	testSharedState(t, addon, "", addonsDir)
+
+	tests := []struct {
+		name      string
+		version   string
+		uploaded  time.Time
+		hasUpdate bool
+	}{
+		{"new addon", "1.0", uploaded, true},
+		{"up to date", "1.0", uploaded, false},
+		{"new upload", "1.0", uploaded.Add(time.Hour), true},
+		{"new version", "1.1", uploaded.Add(time.Hour), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			version, uploaded = tc.version, tc.uploaded
+
+			status := addon.update(t.Context())
+			if status.err != nil {
+				t.Fatalf("error updating addon: %v", status.err)
+			}
+			testEq(t, "hasUpdate", status.hasUpdate, tc.hasUpdate)
+			testEqFunc(t, "Interface", status.asset.Interface, []int{110105}, slices.Equal)
+			testEq(t, "Version", addon.Version, tc.version)
+			testEqFunc(t, "UpdatedOn", addon.UpdatedOn, tc.uploaded, time.Time.Equal)
+			testEq(t, "Addon/Addon.toc", testReadFile(t, addonsDir+"/Addon/Addon.toc"), tc.version)
+		})
+	}
+}
+
+func TestParseWowinterfaceId(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5108", "5108"},
+		{"https://www.wowinterface.com/downloads/info5108-Clique.html", "5108"},
+		{"wowinterface.com/downloads/download5108-Clique", "5108"},
+		{"https://www.wowinterface.com/forums/index.php", ""},
+		{"Clique", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			id, err := parseWowinterfaceId(tc.input)
+			if tc.expected == "" {
+				if err == nil {
+					t.Errorf("expected error parsing %v, got %v", tc.input, id)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("error parsing wowinterface id: %v", err)
+				return
+			}
+			testEq(t, "id", id, tc.expected)
+		})
+	}
+}